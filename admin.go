@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// intentRequest is the body accepted by the admin intent endpoint.
+type intentRequest struct {
+	Intent string            `json:"intent"`
+	Slots  map[string]string `json:"slots"`
+}
+
+// intentResult is the admin API's reply to an invoked intent.
+type intentResult struct {
+	Speech string `json:"speech"`
+}
+
+// roomSummary is a room as listed by the admin API.
+type roomSummary struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	HasReceiver bool     `json:"hasReceiver"`
+	Devices     []device `json:"devices"`
+	Inputs      int      `json:"inputs"`
+}
+
+// newAdminHandler returns the admin API. Every request must carry
+// "Authorization: Bearer <token>".
+func newAdminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rooms", adminListRooms)
+	mux.HandleFunc("GET /rooms/{room}/inputs", withRoom(adminListInputs))
+	mux.HandleFunc("GET /rooms/{room}/state", withRoom(adminGetState))
+	mux.HandleFunc("GET /rooms/{room}/history", withRoom(adminGetHistory))
+	mux.HandleFunc("POST /rooms/{room}/intents", withRoom(adminInvokeIntent))
+	mux.HandleFunc("POST /rooms/{room}/input", withRoom(adminSetInput))
+	mux.HandleFunc("GET /dry-run/calls", adminListDryRunCalls)
+	mux.HandleFunc("DELETE /dry-run/calls", adminResetDryRunCalls)
+	mux.HandleFunc("GET /metrics", metricsHandler)
+	mux.HandleFunc("GET /readyz", readyzHandler)
+	return requireToken(token, mux)
+}
+
+// requireToken rejects requests without the bearer token.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withRoom resolves the {room} path value before calling fn.
+func withRoom(fn func(http.ResponseWriter, *http.Request, Room)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		room, ok := Rooms[r.PathValue("room")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "unknown room")
+			return
+		}
+		fn(w, r, room)
+	}
+}
+
+func adminListRooms(w http.ResponseWriter, r *http.Request) {
+	list := make([]roomSummary, 0, len(Rooms))
+	for _, room := range Rooms {
+		list = append(list, roomSummary{
+			ID:          room.ID,
+			Name:        room.Name,
+			HasReceiver: room.ReceiverHost != "",
+			Devices:     room.devices(),
+			Inputs:      len(room.InputMap),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	writeJSON(w, http.StatusOK, list)
+}
+
+func adminListInputs(w http.ResponseWriter, r *http.Request, room Room) {
+	writeJSON(w, http.StatusOK, room.InputMap)
+}
+
+func adminGetState(w http.ResponseWriter, r *http.Request, room Room) {
+	writeJSON(w, http.StatusOK, states.Get(room.ID))
+}
+
+func adminGetHistory(w http.ResponseWriter, r *http.Request, room Room) {
+	writeJSON(w, http.StatusOK, commands.Recent(room.ID))
+}
+
+func adminInvokeIntent(w http.ResponseWriter, r *http.Request, room Room) {
+	var req intentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Intent == "" {
+		writeError(w, http.StatusBadRequest, "body must be {\"intent\": ..., \"slots\": {...}}")
+		return
+	}
+	writeJSON(w, http.StatusOK, runIntent(room, req.Intent, req.Slots))
+}
+
+func adminSetInput(w http.ResponseWriter, r *http.Request, room Room) {
+	var req struct {
+		Input string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Input == "" {
+		writeError(w, http.StatusBadRequest, "body must be {\"input\": ...}")
+		return
+	}
+	writeJSON(w, http.StatusOK, runIntent(room, "INPUT", map[string]string{"InputType": req.Input}))
+}
+
+func adminListDryRunCalls(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		DryRun bool         `json:"dryRun"`
+		Calls  []DeviceCall `json:"calls"`
+	}{dryRun.Load(), dryRunCalls.Calls()})
+}
+
+func adminResetDryRunCalls(w http.ResponseWriter, r *http.Request) {
+	dryRunCalls.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runIntent sends an intent through the same handler every front-end uses
+// and returns what would be spoken.
+func runIntent(room Room, intent string, slots map[string]string) intentResult {
+	resp := serveIntent(context.Background(), room, &IntentRequest{Intent: intent, Slots: slots})
+	return intentResult{Speech: resp.Text()}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func adminRequest(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdmin_RequiresToken(t *testing.T) {
+	h := newAdminHandler("secret")
+
+	for _, path := range []string{"/rooms", "/metrics", "/readyz"} {
+		for _, auth := range []string{"", "Bearer wrong", "secret"} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s auth %q: expected 401, got %d", path, auth, rec.Code)
+			}
+		}
+	}
+}
+
+func TestAdmin_Metrics(t *testing.T) {
+	rec := adminRequest(t, newAdminHandler("secret"), http.MethodGet, "/metrics", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "alexa_intents_total") {
+		t.Errorf("expected metrics, got %d:\n%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdmin_ListRooms(t *testing.T) {
+	rec := adminRequest(t, newAdminHandler("secret"), http.MethodGet, "/rooms", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var list []roomSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != "fr" || list[1].ID != "mbr" {
+		t.Errorf("unexpected rooms: %+v", list)
+	}
+	if !list[0].HasReceiver || list[1].HasReceiver {
+		t.Errorf("unexpected receiver flags: %+v", list)
+	}
+}
+
+func TestAdmin_UnknownRoom(t *testing.T) {
+	rec := adminRequest(t, newAdminHandler("secret"), http.MethodGet, "/rooms/garage/state", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestAdmin_InvokeIntent(t *testing.T) {
+	tv := &deviceRecorder{}
+	server := httptest.NewServer(tv)
+	defer server.Close()
+
+	room := testRoom(server.URL, "", "")
+	addRoom(t, room)
+	commands = NewCommandLog(commandLogLimit)
+	h := newAdminHandler("secret")
+
+	rec := adminRequest(t, h, http.MethodPost, "/rooms/test/intents", `{"intent": "Channel", "slots": {"Number": "7"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var result intentResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if result.Speech != "Okay." {
+		t.Errorf("unexpected speech: %q", result.Speech)
+	}
+	pending.Wait()
+	if calls := tv.Calls(); len(calls) != 1 || calls[0] != `{"command":"Channel","value":"7"}` {
+		t.Errorf("unexpected TV calls: %v", calls)
+	}
+
+	rec = adminRequest(t, h, http.MethodGet, "/rooms/test/history", "")
+	var history []Command
+	json.Unmarshal(rec.Body.Bytes(), &history)
+	if len(history) != 1 || history[0].Intent != "CHANNEL" || history[0].Slots["Number"] != "7" {
+		t.Errorf("unexpected history: %+v", history)
+	}
+}
+
+func TestAdmin_SetInputAndState(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+
+	room := testRoom(ok.URL, ok.URL, "")
+	addRoom(t, room)
+	h := newAdminHandler("secret")
+
+	rec := adminRequest(t, h, http.MethodPost, "/rooms/test/input", `{"input": "netflix"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	pending.Wait()
+
+	rec = adminRequest(t, h, http.MethodGet, "/rooms/test/state", "")
+	var st RoomState
+	json.Unmarshal(rec.Body.Bytes(), &st)
+	if st.Input != "NETFLIX" || st.RokuApp != "Netflix" {
+		t.Errorf("unexpected state: %+v", st)
+	}
+}
+
+// TestAdmin_SetInputFreeText checks that an input name no Alexa model
+// constrained, quotes and all, reaches the Roku as a JSON string value.
+func TestAdmin_SetInputFreeText(t *testing.T) {
+	tv := &deviceRecorder{}
+	tvServer := httptest.NewServer(tv)
+	defer tvServer.Close()
+	roku := &deviceRecorder{}
+	rokuServer := httptest.NewServer(roku)
+	defer rokuServer.Close()
+
+	room := testRoom(tvServer.URL, rokuServer.URL, "")
+	addRoom(t, room)
+	h := newAdminHandler("secret")
+
+	rec := adminRequest(t, h, http.MethodPost, "/rooms/test/input", `{"input": "my \"show\", \"value\": \"x"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	pending.Wait()
+
+	calls := roku.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected one Roku call, got %v", calls)
+	}
+	var body map[string]string
+	if err := json.Unmarshal([]byte(calls[0]), &body); err != nil || len(body) != 2 || body["value"] != `MY"SHOW","VALUE":"X` {
+		t.Errorf("input name escaped the value: %s (%v)", calls[0], err)
+	}
+}
+
+func TestAdmin_BadIntentBody(t *testing.T) {
+	rec := adminRequest(t, newAdminHandler("secret"), http.MethodPost, "/rooms/fr/intents", `{}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,101 @@
+package alexa
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrNoDirectiveService is returned when a request carries no API endpoint
+// or token, as with simulated requests.
+var ErrNoDirectiveService = errors.New("alexa: request has no directive service endpoint")
+
+// ErrUntrustedEndpoint is returned when a request names an API endpoint that
+// isn't Amazon's; the request's access token is never sent to it.
+var ErrUntrustedEndpoint = errors.New("alexa: request names an untrusted API endpoint")
+
+// APIEndpoints are Amazon's regional Alexa API endpoints.
+var APIEndpoints = []string{
+	"https://api.amazonalexa.com",
+	"https://api.eu.amazonalexa.com",
+	"https://api.fe.amazonalexa.com",
+}
+
+// DirectiveClient sends progressive responses through the Alexa directive
+// service while a request is still being handled.
+type DirectiveClient struct {
+	// HTTPClient sends the directives; nil uses a client with a 2 second
+	// timeout, as a late progressive response is useless.
+	HTTPClient *http.Client
+
+	// Endpoints are the API endpoints directives may be sent to; nil means
+	// APIEndpoints.
+	Endpoints []string
+}
+
+// Allows reports whether c sends directives to endpoint.
+func (c *DirectiveClient) Allows(endpoint string) bool {
+	allowed := c.Endpoints
+	if allowed == nil {
+		allowed = APIEndpoints
+	}
+	return slices.Contains(allowed, strings.TrimSuffix(endpoint, "/"))
+}
+
+type speakDirective struct {
+	Header struct {
+		RequestID string `json:"requestId"`
+	} `json:"header"`
+	Directive struct {
+		Type   string `json:"type"`
+		Speech string `json:"speech"`
+	} `json:"directive"`
+}
+
+// Speak has the device say speech, plain text or SSML, before the final
+// response to req. The request's endpoint must be one c allows.
+func (c *DirectiveClient) Speak(ctx context.Context, req *RequestEnvelope, speech string) error {
+	endpoint, token := req.Context.System.APIEndpoint, req.Context.System.APIAccessToken
+	if endpoint == "" || token == "" {
+		return ErrNoDirectiveService
+	}
+	if !c.Allows(endpoint) {
+		return ErrUntrustedEndpoint
+	}
+
+	var d speakDirective
+	d.Header.RequestID = req.Request.RequestID
+	d.Directive.Type = "VoicePlayer.Speak"
+	d.Directive.Speech = speech
+	body, err := encode(d)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(endpoint, "/") + "/v1/directives"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 2 * time.Second}
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("alexa: POST %s: %s", url, resp.Status)
+	}
+	return nil
+}
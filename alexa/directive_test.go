@@ -0,0 +1,75 @@
+package alexa
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDirectiveClient_Speak(t *testing.T) {
+	var gotPath, gotAuth, gotBody string
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer service.Close()
+
+	req := &RequestEnvelope{}
+	req.Request.RequestID = "amzn1.echo-api.request.1"
+	req.Context.System.APIEndpoint = service.URL
+	req.Context.System.APIAccessToken = "api-token"
+
+	c := &DirectiveClient{Endpoints: []string{service.URL}}
+	if err := c.Speak(context.Background(), req, "Switching to <say-as>Netflix</say-as>."); err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/v1/directives" || gotAuth != "Bearer api-token" {
+		t.Errorf("path %q, auth %q", gotPath, gotAuth)
+	}
+	want := `{"header":{"requestId":"amzn1.echo-api.request.1"},"directive":{"type":"VoicePlayer.Speak","speech":"Switching to <say-as>Netflix</say-as>."}}`
+	if gotBody != want {
+		t.Errorf("body:\ngot  %s\nwant %s", gotBody, want)
+	}
+}
+
+func TestDirectiveClient_Errors(t *testing.T) {
+	c := &DirectiveClient{}
+	if err := c.Speak(context.Background(), &RequestEnvelope{}, "Hi."); err != ErrNoDirectiveService {
+		t.Errorf("no endpoint: err = %v", err)
+	}
+
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer service.Close()
+	req := &RequestEnvelope{}
+	req.Context.System.APIEndpoint = service.URL
+	req.Context.System.APIAccessToken = "expired"
+	if err := c.Speak(context.Background(), req, "Hi."); err != ErrUntrustedEndpoint {
+		t.Errorf("untrusted endpoint: err = %v", err)
+	}
+	c.Endpoints = []string{service.URL}
+	if err := c.Speak(context.Background(), req, "Hi."); err == nil {
+		t.Error("expected error for a 403")
+	}
+}
+
+func TestDirectiveClient_Allows(t *testing.T) {
+	c := &DirectiveClient{}
+	for endpoint, want := range map[string]bool{
+		"https://api.amazonalexa.com":         true,
+		"https://api.eu.amazonalexa.com/":     true,
+		"https://api.fe.amazonalexa.com":      true,
+		"http://api.amazonalexa.com":          false,
+		"https://api.amazonalexa.com.evil.io": false,
+		"http://169.254.169.254":              false,
+	} {
+		if got := c.Allows(endpoint); got != want {
+			t.Errorf("Allows(%q) = %t, want %t", endpoint, got, want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Package alexa is the Alexa Skills Kit model for a custom skill hosted as a
+// web service: the request and response JSON, a Skill that verifies and
+// dispatches requests by type, and the signature checks Amazon requires.
+package alexa
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Request types.
+const (
+	TypeLaunch               = "LaunchRequest"
+	TypeIntent               = "IntentRequest"
+	TypeSessionEnded         = "SessionEndedRequest"
+	TypeCanFulfillIntent     = "CanFulfillIntentRequest"
+	TypeElementSelected      = "Display.ElementSelected"
+	TypeAPLUserEvent         = "Alexa.Presentation.APL.UserEvent"
+	TypeExceptionEncountered = "System.ExceptionEncountered"
+)
+
+// Confirmation and dialog states.
+const (
+	ConfirmationNone      = "NONE"
+	ConfirmationConfirmed = "CONFIRMED"
+	ConfirmationDenied    = "DENIED"
+
+	DialogStarted    = "STARTED"
+	DialogInProgress = "IN_PROGRESS"
+	DialogCompleted  = "COMPLETED"
+)
+
+// ErrNoSlot is returned for a slot the request doesn't have or left empty.
+var ErrNoSlot = errors.New("slot not found")
+
+// RequestEnvelope is everything Alexa sends to the skill.
+type RequestEnvelope struct {
+	Version string  `json:"version"`
+	Session Session `json:"session"`
+	Context Context `json:"context"`
+	Request Request `json:"request"`
+}
+
+// Session describes the conversation the request belongs to. Requests
+// outside a session, such as AudioPlayer events, leave it empty.
+type Session struct {
+	New         bool           `json:"new"`
+	SessionID   string         `json:"sessionId"`
+	Application Application    `json:"application"`
+	Attributes  map[string]any `json:"attributes,omitempty"`
+	User        User           `json:"user"`
+}
+
+// Application identifies the skill.
+type Application struct {
+	ApplicationID string `json:"applicationId"`
+}
+
+// User is the Amazon account that invoked the skill.
+type User struct {
+	UserID      string       `json:"userId"`
+	AccessToken string       `json:"accessToken,omitempty"`
+	Permissions *Permissions `json:"permissions,omitempty"`
+}
+
+// Permissions carries the consent token for customer data the user granted.
+type Permissions struct {
+	ConsentToken string `json:"consentToken,omitempty"`
+}
+
+// Context is the state of the device and services when the request was made.
+type Context struct {
+	System      System           `json:"System"`
+	AudioPlayer *AudioPlayer     `json:"AudioPlayer,omitempty"`
+	Viewport    *Viewport        `json:"Viewport,omitempty"`
+	Viewports   []map[string]any `json:"Viewports,omitempty"`
+	// APL is the state of the visible APL document, if any.
+	APL json.RawMessage `json:"Alexa.Presentation.APL,omitempty"`
+}
+
+// System identifies the device, user and skill, and gives the endpoint and
+// token for calling Alexa APIs such as the directive service.
+type System struct {
+	Application    Application `json:"application"`
+	User           User        `json:"user"`
+	Person         *Person     `json:"person,omitempty"`
+	Device         Device      `json:"device"`
+	APIEndpoint    string      `json:"apiEndpoint,omitempty"`
+	APIAccessToken string      `json:"apiAccessToken,omitempty"`
+}
+
+// Person is the recognized speaker, when voice profiles are enabled.
+type Person struct {
+	PersonID    string `json:"personId"`
+	AccessToken string `json:"accessToken,omitempty"`
+}
+
+// Device is the Echo the request came from.
+type Device struct {
+	DeviceID            string                     `json:"deviceId,omitempty"`
+	SupportedInterfaces map[string]json.RawMessage `json:"supportedInterfaces,omitempty"`
+}
+
+// Supports reports whether the device has an interface such as "Display",
+// "AudioPlayer" or "Alexa.Presentation.APL".
+func (d Device) Supports(iface string) bool {
+	_, ok := d.SupportedInterfaces[iface]
+	return ok
+}
+
+// AudioPlayer is the device's audio playback state.
+type AudioPlayer struct {
+	Token                string `json:"token,omitempty"`
+	OffsetInMilliseconds int64  `json:"offsetInMilliseconds,omitempty"`
+	PlayerActivity       string `json:"playerActivity,omitempty"`
+}
+
+// Viewport describes the device's screen.
+type Viewport struct {
+	Shape              string   `json:"shape,omitempty"`
+	PixelWidth         int      `json:"pixelWidth,omitempty"`
+	PixelHeight        int      `json:"pixelHeight,omitempty"`
+	DPI                int      `json:"dpi,omitempty"`
+	CurrentPixelWidth  int      `json:"currentPixelWidth,omitempty"`
+	CurrentPixelHeight int      `json:"currentPixelHeight,omitempty"`
+	Touch              []string `json:"touch,omitempty"`
+}
+
+// Request is the request body. Its fields are the union of every request
+// type; Type says which apply.
+type Request struct {
+	Type        string `json:"type"`
+	RequestID   string `json:"requestId"`
+	Timestamp   string `json:"timestamp"`
+	Locale      string `json:"locale,omitempty"`
+	DialogState string `json:"dialogState,omitempty"`
+	Intent      Intent `json:"intent,omitzero"`
+
+	// SessionEndedRequest
+	Reason string `json:"reason,omitempty"`
+	Error  *Error `json:"error,omitempty"`
+
+	// AudioPlayer, Display.ElementSelected and APL events
+	Token                string `json:"token,omitempty"`
+	OffsetInMilliseconds int64  `json:"offsetInMilliseconds,omitempty"`
+
+	// Alexa.Presentation.APL.UserEvent
+	Arguments []any          `json:"arguments,omitempty"`
+	Source    map[string]any `json:"source,omitempty"`
+	// Components holds the values of APL components with an ID.
+	Components map[string]any `json:"components,omitempty"`
+
+	// System.ExceptionEncountered
+	Cause *struct {
+		RequestID string `json:"requestId"`
+	} `json:"cause,omitempty"`
+}
+
+// Error describes why a session ended or what failed.
+type Error struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// Intent is the action the user asked for.
+type Intent struct {
+	Name               string          `json:"name"`
+	ConfirmationStatus string          `json:"confirmationStatus,omitempty"`
+	Slots              map[string]Slot `json:"slots,omitempty"`
+}
+
+// Slot is one value in an intent.
+type Slot struct {
+	Name               string       `json:"name"`
+	Value              string       `json:"value,omitempty"`
+	ConfirmationStatus string       `json:"confirmationStatus,omitempty"`
+	Resolutions        *Resolutions `json:"resolutions,omitempty"`
+}
+
+// Resolutions are the entity resolution results for a slot.
+type Resolutions struct {
+	ResolutionsPerAuthority []Resolution `json:"resolutionsPerAuthority"`
+}
+
+// Resolution is one authority's match for a slot value.
+type Resolution struct {
+	Authority string `json:"authority"`
+	Status    struct {
+		Code string `json:"code"`
+	} `json:"status"`
+	Values []struct {
+		Value ResolvedValue `json:"value"`
+	} `json:"values,omitempty"`
+}
+
+// ResolvedValue is a canonical slot value and its ID.
+type ResolvedValue struct {
+	Name string `json:"name"`
+	ID   string `json:"id,omitempty"`
+}
+
+// Resolved returns the first value entity resolution matched, falling back
+// to what was heard. Synonyms resolve to their canonical value this way.
+func (s Slot) Resolved() string {
+	if s.Resolutions != nil {
+		for _, r := range s.Resolutions.ResolutionsPerAuthority {
+			if r.Status.Code == "ER_SUCCESS_MATCH" && len(r.Values) > 0 {
+				return r.Values[0].Value.Name
+			}
+		}
+	}
+	return s.Value
+}
+
+// RequestType returns the request's type, such as "IntentRequest".
+func (r *RequestEnvelope) RequestType() string {
+	return r.Request.Type
+}
+
+// IntentName returns the intent's name, or "" for other request types.
+func (r *RequestEnvelope) IntentName() string {
+	return r.Request.Intent.Name
+}
+
+// Slots returns the intent's slots.
+func (r *RequestEnvelope) Slots() map[string]Slot {
+	return r.Request.Intent.Slots
+}
+
+// SlotValue returns what the user said for a slot, or ErrNoSlot if the slot
+// is missing or empty.
+func (r *RequestEnvelope) SlotValue(name string) (string, error) {
+	slot, ok := r.Request.Intent.Slots[name]
+	if !ok || slot.Value == "" {
+		return "", ErrNoSlot
+	}
+	return slot.Value, nil
+}
+
+// UserID returns the user's ID from the session, or from the context for
+// requests outside a session.
+func (r *RequestEnvelope) UserID() string {
+	if r.Session.User.UserID != "" {
+		return r.Session.User.UserID
+	}
+	return r.Context.System.User.UserID
+}
+
+// ApplicationID returns the skill ID the request was sent to.
+func (r *RequestEnvelope) ApplicationID() string {
+	if r.Session.Application.ApplicationID != "" {
+		return r.Session.Application.ApplicationID
+	}
+	return r.Context.System.Application.ApplicationID
+}
+
+// timestampTolerance is how old Amazon allows a request to be.
+const timestampTolerance = 150 * time.Second
+
+// VerifyTimestamp reports whether the request was made within the last 150
+// seconds of now, as skill certification requires.
+func (r *RequestEnvelope) VerifyTimestamp(now time.Time) bool {
+	ts, err := time.Parse(time.RFC3339, r.Request.Timestamp)
+	if err != nil {
+		return false
+	}
+	d := now.Sub(ts)
+	return d < timestampTolerance && d > -timestampTolerance
+}
@@ -0,0 +1,80 @@
+package alexa
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func loadRequest(t *testing.T) *RequestEnvelope {
+	t.Helper()
+	data, err := os.ReadFile("testdata/intent_request.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req RequestEnvelope
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatal(err)
+	}
+	return &req
+}
+
+func TestRequestEnvelope_Decode(t *testing.T) {
+	req := loadRequest(t)
+
+	if req.RequestType() != TypeIntent || req.IntentName() != "Input" || req.Request.DialogState != DialogStarted {
+		t.Errorf("request = %+v", req.Request)
+	}
+	if req.ApplicationID() != "amzn1.ask.skill.fr" || req.UserID() != "amzn1.ask.account.1" {
+		t.Errorf("ids = %s, %s", req.ApplicationID(), req.UserID())
+	}
+	if req.Context.System.APIEndpoint != "https://api.amazonalexa.com" || req.Context.System.APIAccessToken != "api-token" {
+		t.Errorf("system = %+v", req.Context.System)
+	}
+	if !req.Context.System.Device.Supports("Alexa.Presentation.APL") || req.Context.System.Device.Supports("AudioPlayer") {
+		t.Error("supported interfaces not decoded")
+	}
+	if req.Context.Viewport == nil || req.Context.Viewport.PixelWidth != 1280 {
+		t.Errorf("viewport = %+v", req.Context.Viewport)
+	}
+}
+
+func TestRequestEnvelope_Slots(t *testing.T) {
+	req := loadRequest(t)
+
+	if v, err := req.SlotValue("InputType"); err != nil || v != "the roku" {
+		t.Errorf("SlotValue(InputType) = %q, %v", v, err)
+	}
+	if got := req.Slots()["InputType"].Resolved(); got != "roku" {
+		t.Errorf("Resolved = %q, want roku", got)
+	}
+	if _, err := req.SlotValue("Amount"); err != ErrNoSlot {
+		t.Errorf("empty slot: err = %v", err)
+	}
+	if _, err := req.SlotValue("Missing"); err != ErrNoSlot {
+		t.Errorf("missing slot: err = %v", err)
+	}
+	if got := (Slot{Value: "netflix"}).Resolved(); got != "netflix" {
+		t.Errorf("unresolved slot = %q", got)
+	}
+}
+
+func TestRequestEnvelope_VerifyTimestamp(t *testing.T) {
+	req := loadRequest(t)
+	sent := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		now  time.Time
+		want bool
+	}{
+		{sent.Add(10 * time.Second), true},
+		{sent.Add(149 * time.Second), true},
+		{sent.Add(151 * time.Second), false},
+		{sent.Add(-151 * time.Second), false},
+	} {
+		if got := req.VerifyTimestamp(tt.now); got != tt.want {
+			t.Errorf("VerifyTimestamp(%v) = %v, want %v", tt.now.Sub(sent), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package alexa
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// ResponseEnvelope is the skill's reply.
+type ResponseEnvelope struct {
+	Version           string         `json:"version"`
+	SessionAttributes map[string]any `json:"sessionAttributes,omitempty"`
+	Response          Response       `json:"response"`
+}
+
+// Response is what Alexa says, shows and does.
+type Response struct {
+	OutputSpeech *OutputSpeech `json:"outputSpeech,omitempty"`
+	Card         *Card         `json:"card,omitempty"`
+	Reprompt     *Reprompt     `json:"reprompt,omitempty"`
+	Directives   []any         `json:"directives,omitempty"`
+	// ShouldEndSession is nil to leave the session state to the device, as
+	// AudioPlayer and APL responses sometimes must.
+	ShouldEndSession *bool `json:"shouldEndSession,omitempty"`
+}
+
+// OutputSpeech is plain text or SSML for Alexa to speak.
+type OutputSpeech struct {
+	Type         string `json:"type"`
+	Text         string `json:"text,omitempty"`
+	SSML         string `json:"ssml,omitempty"`
+	PlayBehavior string `json:"playBehavior,omitempty"`
+}
+
+// Reprompt is spoken if the user doesn't answer while the session is open.
+type Reprompt struct {
+	OutputSpeech OutputSpeech `json:"outputSpeech"`
+}
+
+// Card is shown in the Alexa app and on devices with a screen.
+type Card struct {
+	Type    string `json:"type"`
+	Title   string `json:"title,omitempty"`
+	Content string `json:"content,omitempty"` // Simple cards
+	Text    string `json:"text,omitempty"`    // Standard cards
+	Image   *Image `json:"image,omitempty"`
+}
+
+// Image is a Standard card's image in two sizes.
+type Image struct {
+	SmallImageURL string `json:"smallImageUrl,omitempty"`
+	LargeImageURL string `json:"largeImageUrl,omitempty"`
+}
+
+// DialogDirective hands the conversation back to Alexa's dialog model:
+// Dialog.Delegate, Dialog.ElicitSlot, Dialog.ConfirmSlot or
+// Dialog.ConfirmIntent.
+type DialogDirective struct {
+	Type          string  `json:"type"`
+	SlotToElicit  string  `json:"slotToElicit,omitempty"`
+	SlotToConfirm string  `json:"slotToConfirm,omitempty"`
+	UpdatedIntent *Intent `json:"updatedIntent,omitempty"`
+}
+
+// RenderDocumentDirective displays an APL document.
+type RenderDocumentDirective struct {
+	Type        string          `json:"type"` // "Alexa.Presentation.APL.RenderDocument"
+	Token       string          `json:"token,omitempty"`
+	Document    json.RawMessage `json:"document"`
+	Datasources map[string]any  `json:"datasources,omitempty"`
+}
+
+// AudioPlayerDirective starts, stops or clears audio playback.
+type AudioPlayerDirective struct {
+	Type          string     `json:"type"` // "AudioPlayer.Play", "AudioPlayer.Stop" or "AudioPlayer.ClearQueue"
+	PlayBehavior  string     `json:"playBehavior,omitempty"`
+	ClearBehavior string     `json:"clearBehavior,omitempty"`
+	AudioItem     *AudioItem `json:"audioItem,omitempty"`
+}
+
+// AudioItem is the stream an AudioPlayer.Play directive plays.
+type AudioItem struct {
+	Stream struct {
+		URL                   string `json:"url"`
+		Token                 string `json:"token"`
+		ExpectedPreviousToken string `json:"expectedPreviousToken,omitempty"`
+		OffsetInMilliseconds  int64  `json:"offsetInMilliseconds"`
+	} `json:"stream"`
+}
+
+// NewResponse returns an empty response that ends the session.
+func NewResponse() *ResponseEnvelope {
+	end := true
+	return &ResponseEnvelope{Version: "1.0", Response: Response{ShouldEndSession: &end}}
+}
+
+// OutputSpeech sets plain-text speech.
+func (r *ResponseEnvelope) OutputSpeech(text string) *ResponseEnvelope {
+	r.Response.OutputSpeech = &OutputSpeech{Type: "PlainText", Text: text}
+	return r
+}
+
+// OutputSpeechSSML sets SSML speech; ssml must be wrapped in <speak>.
+func (r *ResponseEnvelope) OutputSpeechSSML(ssml string) *ResponseEnvelope {
+	r.Response.OutputSpeech = &OutputSpeech{Type: "SSML", SSML: ssml}
+	return r
+}
+
+// SimpleCard sets a card with a title and plain text.
+func (r *ResponseEnvelope) SimpleCard(title, content string) *ResponseEnvelope {
+	r.Response.Card = &Card{Type: "Simple", Title: title, Content: content}
+	return r
+}
+
+// StandardCard sets a card with a title, text and image.
+func (r *ResponseEnvelope) StandardCard(title, text, smallImageURL, largeImageURL string) *ResponseEnvelope {
+	r.Response.Card = &Card{Type: "Standard", Title: title, Text: text}
+	if smallImageURL != "" || largeImageURL != "" {
+		r.Response.Card.Image = &Image{SmallImageURL: smallImageURL, LargeImageURL: largeImageURL}
+	}
+	return r
+}
+
+// LinkAccountCard asks the user to link their account in the Alexa app.
+func (r *ResponseEnvelope) LinkAccountCard() *ResponseEnvelope {
+	r.Response.Card = &Card{Type: "LinkAccount"}
+	return r
+}
+
+// Reprompt sets plain-text speech for when the user doesn't answer, and
+// keeps the session open.
+func (r *ResponseEnvelope) Reprompt(text string) *ResponseEnvelope {
+	r.Response.Reprompt = &Reprompt{OutputSpeech: OutputSpeech{Type: "PlainText", Text: text}}
+	return r.EndSession(false)
+}
+
+// RepromptSSML sets SSML speech for when the user doesn't answer, and keeps
+// the session open.
+func (r *ResponseEnvelope) RepromptSSML(ssml string) *ResponseEnvelope {
+	r.Response.Reprompt = &Reprompt{OutputSpeech: OutputSpeech{Type: "SSML", SSML: ssml}}
+	return r.EndSession(false)
+}
+
+// EndSession sets whether the session ends after this response.
+func (r *ResponseEnvelope) EndSession(end bool) *ResponseEnvelope {
+	r.Response.ShouldEndSession = &end
+	return r
+}
+
+// AddDirective appends a directive, such as a DialogDirective or
+// RenderDocumentDirective.
+func (r *ResponseEnvelope) AddDirective(d any) *ResponseEnvelope {
+	r.Response.Directives = append(r.Response.Directives, d)
+	return r
+}
+
+// ElicitSlot asks the user for a slot with the given prompt and keeps the
+// session open for the answer.
+func (r *ResponseEnvelope) ElicitSlot(slot, prompt string, intent *Intent) *ResponseEnvelope {
+	r.AddDirective(DialogDirective{Type: "Dialog.ElicitSlot", SlotToElicit: slot, UpdatedIntent: intent})
+	return r.OutputSpeech(prompt).Reprompt(prompt)
+}
+
+// Speech returns the plain-text or SSML speech, or "".
+func (r *ResponseEnvelope) Speech() string {
+	if r.Response.OutputSpeech == nil {
+		return ""
+	}
+	if r.Response.OutputSpeech.Type == "SSML" {
+		return r.Response.OutputSpeech.SSML
+	}
+	return r.Response.OutputSpeech.Text
+}
+
+// encode marshals v without escaping <, > and &, so SSML stays readable.
+func encode(v any) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,55 @@
+package alexa
+
+import "testing"
+
+func TestResponseEnvelope_JSON(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *ResponseEnvelope
+		want string
+	}{
+		{
+			"speech",
+			NewResponse().OutputSpeech("Hi."),
+			`{"version":"1.0","response":{"outputSpeech":{"type":"PlainText","text":"Hi."},"shouldEndSession":true}}`,
+		},
+		{
+			"card and reprompt",
+			NewResponse().OutputSpeechSSML("<speak>Which input?</speak>").SimpleCard("Input", "Which input?").Reprompt("Which input?"),
+			`{"version":"1.0","response":{"outputSpeech":{"type":"SSML","ssml":"<speak>Which input?</speak>"},` +
+				`"card":{"type":"Simple","title":"Input","content":"Which input?"},` +
+				`"reprompt":{"outputSpeech":{"type":"PlainText","text":"Which input?"}},"shouldEndSession":false}}`,
+		},
+		{
+			"elicit slot",
+			NewResponse().ElicitSlot("InputType", "Which input?", nil),
+			`{"version":"1.0","response":{"outputSpeech":{"type":"PlainText","text":"Which input?"},` +
+				`"reprompt":{"outputSpeech":{"type":"PlainText","text":"Which input?"}},` +
+				`"directives":[{"type":"Dialog.ElicitSlot","slotToElicit":"InputType"}],"shouldEndSession":false}}`,
+		},
+		{
+			"standard card",
+			NewResponse().StandardCard("Family Room", "On Netflix.", "https://example.com/s.png", ""),
+			`{"version":"1.0","response":{"card":{"type":"Standard","title":"Family Room","text":"On Netflix.",` +
+				`"image":{"smallImageUrl":"https://example.com/s.png"}},"shouldEndSession":true}}`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := encode(tt.resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResponseEnvelope_Speech(t *testing.T) {
+	if got := NewResponse().Speech(); got != "" {
+		t.Errorf("empty response speech = %q", got)
+	}
+	if got := NewResponse().OutputSpeechSSML("<speak>Hi</speak>").Speech(); got != "<speak>Hi</speak>" {
+		t.Errorf("SSML speech = %q", got)
+	}
+}
@@ -0,0 +1,113 @@
+package alexa
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HandlerFunc handles one request by filling in resp.
+type HandlerFunc func(req *RequestEnvelope, resp *ResponseEnvelope)
+
+// Skill is the HTTP endpoint for one skill. It verifies and decodes each
+// request, then calls the handler registered for the request's type.
+type Skill struct {
+	// AppID is the skill ID requests must be addressed to.
+	AppID string
+	// Verifier checks request signatures. Nil skips the check, for local
+	// testing or behind a proxy that has already verified the request; the
+	// _dev query parameter then also skips the timestamp check.
+	Verifier *Verifier
+
+	handlers map[string]HandlerFunc
+}
+
+// NewSkill returns a skill for the given skill ID with no handlers.
+func NewSkill(appID string) *Skill {
+	return &Skill{AppID: appID, handlers: make(map[string]HandlerFunc)}
+}
+
+// Handle registers h for a request type such as TypeIntent. A type ending
+// in "." is a prefix, so "AudioPlayer." handles every AudioPlayer event.
+func (s *Skill) Handle(requestType string, h HandlerFunc) *Skill {
+	if s.handlers == nil {
+		s.handlers = make(map[string]HandlerFunc)
+	}
+	s.handlers[requestType] = h
+	return s
+}
+
+// handler returns the handler for a request type, if any.
+func (s *Skill) handler(requestType string) HandlerFunc {
+	if h, ok := s.handlers[requestType]; ok {
+		return h
+	}
+	for prefix, h := range s.handlers {
+		if strings.HasSuffix(prefix, ".") && strings.HasPrefix(requestType, prefix) {
+			return h
+		}
+	}
+	return nil
+}
+
+func (s *Skill) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	if s.Verifier != nil {
+		if err := s.Verifier.Verify(r, body); err != nil {
+			slog.Warn("rejected alexa request", "path", r.URL.Path, "err", err)
+			http.Error(w, "Not Authorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var req RequestEnvelope
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	dev := s.Verifier == nil && r.URL.Query().Get("_dev") != ""
+	if !dev && !req.VerifyTimestamp(time.Now()) {
+		slog.Warn("alexa request too old", "path", r.URL.Path, "timestamp", req.Request.Timestamp)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if req.ApplicationID() != s.AppID {
+		slog.Warn("alexa skill ID mismatch", "path", r.URL.Path, "app_id", req.ApplicationID())
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	resp := NewResponse()
+	h := s.handler(req.RequestType())
+	switch {
+	case h != nil:
+		h(&req, resp)
+	case req.RequestType() == TypeSessionEnded:
+		// Alexa expects an empty reply.
+	default:
+		http.Error(w, "Unsupported request type.", http.StatusBadRequest)
+		return
+	}
+
+	out, err := encode(resp)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Write(out)
+}
@@ -0,0 +1,77 @@
+package alexa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRequest(requestType, appID string, sent time.Time) string {
+	req := RequestEnvelope{Version: "1.0"}
+	req.Session.Application.ApplicationID = appID
+	req.Request = Request{Type: requestType, RequestID: "req", Timestamp: sent.UTC().Format(time.RFC3339)}
+	req.Request.Intent.Name = "Status"
+	body, _ := json.Marshal(req)
+	return string(body)
+}
+
+func TestSkill_Dispatch(t *testing.T) {
+	var handled []string
+	skill := NewSkill("amzn1.ask.skill.test").
+		Handle(TypeIntent, func(req *RequestEnvelope, resp *ResponseEnvelope) {
+			handled = append(handled, req.IntentName())
+			resp.OutputSpeech("Handled.")
+		}).
+		Handle("AudioPlayer.", func(req *RequestEnvelope, resp *ResponseEnvelope) {
+			handled = append(handled, req.RequestType())
+		})
+
+	tests := []struct {
+		name, requestType, appID, query string
+		sent                            time.Time
+		want                            int
+	}{
+		{"intent", TypeIntent, "amzn1.ask.skill.test", "", time.Now(), http.StatusOK},
+		{"prefix", "AudioPlayer.PlaybackStarted", "amzn1.ask.skill.test", "", time.Now(), http.StatusOK},
+		{"session ended without handler", TypeSessionEnded, "amzn1.ask.skill.test", "", time.Now(), http.StatusOK},
+		{"unsupported", TypeLaunch, "amzn1.ask.skill.test", "", time.Now(), http.StatusBadRequest},
+		{"wrong skill", TypeIntent, "amzn1.ask.skill.other", "", time.Now(), http.StatusBadRequest},
+		{"stale", TypeIntent, "amzn1.ask.skill.test", "", time.Now().Add(-time.Hour), http.StatusBadRequest},
+		{"stale in dev mode", TypeIntent, "amzn1.ask.skill.test", "?_dev=1", time.Now().Add(-time.Hour), http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		body := newTestRequest(tt.requestType, tt.appID, tt.sent)
+		skill.ServeHTTP(rec, httptest.NewRequest("POST", "/echo/test"+tt.query, strings.NewReader(body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	if want := []string{"Status", "AudioPlayer.PlaybackStarted", "Status"}; strings.Join(handled, ",") != strings.Join(want, ",") {
+		t.Errorf("handled = %v, want %v", handled, want)
+	}
+
+	rec := httptest.NewRecorder()
+	skill.ServeHTTP(rec, httptest.NewRequest("POST", "/echo/test", strings.NewReader(newTestRequest(TypeIntent, "amzn1.ask.skill.test", time.Now()))))
+	if got := rec.Body.String(); got != `{"version":"1.0","response":{"outputSpeech":{"type":"PlainText","text":"Handled."},"shouldEndSession":true}}` {
+		t.Errorf("body = %s", got)
+	}
+}
+
+func TestSkill_RejectsUnsignedRequests(t *testing.T) {
+	skill := NewSkill("amzn1.ask.skill.test").Handle(TypeIntent, func(*RequestEnvelope, *ResponseEnvelope) {
+		t.Error("handler called for an unsigned request")
+	})
+	skill.Verifier = &Verifier{}
+
+	rec := httptest.NewRecorder()
+	body := newTestRequest(TypeIntent, "amzn1.ask.skill.test", time.Now())
+	skill.ServeHTTP(rec, httptest.NewRequest("POST", "/echo/test?_dev=1", strings.NewReader(body)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,216 @@
+package alexa
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Smart Home error types used in ErrorResponse events.
+const (
+	ErrorEndpointUnreachable = "ENDPOINT_UNREACHABLE"
+	ErrorInternal            = "INTERNAL_ERROR"
+	ErrorInvalidDirective    = "INVALID_DIRECTIVE"
+	ErrorInvalidValue        = "INVALID_VALUE"
+	ErrorNoSuchEndpoint      = "NO_SUCH_ENDPOINT"
+	// ErrorNotSupportedInCurrentMode is sent with ModeErrorResponse.
+	ErrorNotSupportedInCurrentMode = "NOT_SUPPORTED_IN_CURRENT_MODE"
+)
+
+// SmartHomeRequest is a Smart Home skill directive, as passed to the skill's
+// Lambda function.
+type SmartHomeRequest struct {
+	Directive Directive `json:"directive"`
+}
+
+// Directive asks an endpoint to do something, or asks for discovery.
+type Directive struct {
+	Header   Header          `json:"header"`
+	Endpoint *Endpoint       `json:"endpoint,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// Header identifies a directive or event.
+type Header struct {
+	Namespace        string `json:"namespace"`
+	Name             string `json:"name"`
+	PayloadVersion   string `json:"payloadVersion"`
+	MessageID        string `json:"messageId"`
+	CorrelationToken string `json:"correlationToken,omitempty"`
+}
+
+// Endpoint names the device a directive is for.
+type Endpoint struct {
+	Scope      *Scope            `json:"scope,omitempty"`
+	EndpointID string            `json:"endpointId"`
+	Cookie     map[string]string `json:"cookie,omitempty"`
+}
+
+// Scope carries the linked account's token.
+type Scope struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+// SmartHomeResponse is the event a skill returns for a directive.
+type SmartHomeResponse struct {
+	Event   Event         `json:"event"`
+	Context *EventContext `json:"context,omitempty"`
+}
+
+// Event is the body of a SmartHomeResponse.
+type Event struct {
+	Header   Header    `json:"header"`
+	Endpoint *Endpoint `json:"endpoint,omitempty"`
+	Payload  any       `json:"payload"`
+}
+
+// EventContext reports the endpoint's state after a directive.
+type EventContext struct {
+	Properties []Property `json:"properties"`
+}
+
+// Property is one reported state value, such as Alexa.PowerController
+// powerState.
+type Property struct {
+	Namespace                 string `json:"namespace"`
+	Name                      string `json:"name"`
+	Value                     any    `json:"value"`
+	TimeOfSample              string `json:"timeOfSample"`
+	UncertaintyInMilliseconds int    `json:"uncertaintyInMilliseconds"`
+}
+
+// NewProperty returns a property sampled at t.
+func NewProperty(namespace, name string, value any, t time.Time) Property {
+	return Property{Namespace: namespace, Name: name, Value: value, TimeOfSample: t.UTC().Format(time.RFC3339)}
+}
+
+// DiscoveryEndpoint describes one device in a Discover.Response.
+type DiscoveryEndpoint struct {
+	EndpointID        string       `json:"endpointId"`
+	ManufacturerName  string       `json:"manufacturerName"`
+	FriendlyName      string       `json:"friendlyName"`
+	Description       string       `json:"description"`
+	DisplayCategories []string     `json:"displayCategories"`
+	Capabilities      []Capability `json:"capabilities"`
+}
+
+// Capability is one interface an endpoint supports.
+type Capability struct {
+	Type                string                `json:"type"` // "AlexaInterface"
+	Interface           string                `json:"interface"`
+	Version             string                `json:"version"`
+	Properties          *CapabilityProperties `json:"properties,omitempty"`
+	Inputs              []NamedInput          `json:"inputs,omitempty"`              // Alexa.InputController
+	SupportedOperations []string              `json:"supportedOperations,omitempty"` // Alexa.PlaybackController
+}
+
+// CapabilityProperties lists the properties a capability reports.
+type CapabilityProperties struct {
+	Supported           []SupportedProperty `json:"supported"`
+	ProactivelyReported bool                `json:"proactivelyReported"`
+	Retrievable         bool                `json:"retrievable"`
+}
+
+// SupportedProperty names a reported property.
+type SupportedProperty struct {
+	Name string `json:"name"`
+}
+
+// NamedInput is an input an InputController endpoint can switch to.
+type NamedInput struct {
+	Name string `json:"name"`
+}
+
+// NewCapability returns an interface capability reporting the named
+// properties, which are retrievable but not proactively reported.
+func NewCapability(iface string, properties ...string) Capability {
+	c := Capability{Type: "AlexaInterface", Interface: iface, Version: "3"}
+	if len(properties) > 0 {
+		c.Properties = &CapabilityProperties{Retrievable: true}
+		for _, name := range properties {
+			c.Properties.Supported = append(c.Properties.Supported, SupportedProperty{Name: name})
+		}
+	}
+	return c
+}
+
+// Response returns an event answering d in namespace and name, such as
+// "Alexa" "Response" or "Alexa.Discovery" "Discover.Response".
+func (d *Directive) Response(namespace, name string, payload any) *SmartHomeResponse {
+	if payload == nil {
+		payload = struct{}{}
+	}
+	return &SmartHomeResponse{Event: Event{
+		Header: Header{
+			Namespace:        namespace,
+			Name:             name,
+			PayloadVersion:   "3",
+			MessageID:        newMessageID(),
+			CorrelationToken: d.Header.CorrelationToken,
+		},
+		Endpoint: d.Endpoint,
+		Payload:  payload,
+	}}
+}
+
+// ErrorResponse returns an Alexa.ErrorResponse event for d.
+func (d *Directive) ErrorResponse(errorType, message string) *SmartHomeResponse {
+	return d.Response("Alexa", "ErrorResponse", map[string]string{"type": errorType, "message": message})
+}
+
+// ModeErrorResponse returns a NOT_SUPPORTED_IN_CURRENT_MODE error event for
+// d. mode is the endpoint's current mode: "ASLEEP", "COLOR",
+// "NOT_PROVISIONED" or "OTHER".
+func (d *Directive) ModeErrorResponse(mode, message string) *SmartHomeResponse {
+	return d.Response("Alexa", "ErrorResponse", map[string]string{
+		"type":              ErrorNotSupportedInCurrentMode,
+		"message":           message,
+		"currentDeviceMode": mode,
+	})
+}
+
+func newMessageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SmartHomeFunc handles one Smart Home directive.
+type SmartHomeFunc func(ctx context.Context, d *Directive) *SmartHomeResponse
+
+// Invoke decodes a raw directive and encodes the reply, the way a Lambda
+// function is invoked.
+func (f SmartHomeFunc) Invoke(ctx context.Context, event []byte) ([]byte, error) {
+	var req SmartHomeRequest
+	if err := json.Unmarshal(event, &req); err != nil {
+		return nil, err
+	}
+	if req.Directive.Header.Namespace == "" {
+		return nil, errors.New("alexa: event has no directive")
+	}
+	return encode(f(ctx, &req.Directive))
+}
+
+// ServeHTTP handles directives forwarded by a Lambda proxy.
+func (f SmartHomeFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	out, err := f.Invoke(r.Context(), body)
+	if err != nil {
+		slog.Warn("bad smart home directive", "err", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
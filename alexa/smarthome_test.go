@@ -0,0 +1,68 @@
+package alexa
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSmartHomeFunc_Invoke(t *testing.T) {
+	var got *Directive
+	f := SmartHomeFunc(func(ctx context.Context, d *Directive) *SmartHomeResponse {
+		got = d
+		return d.ErrorResponse(ErrorNoSuchEndpoint, "no such TV")
+	})
+
+	event := `{"directive": {"header": {"namespace": "Alexa.PowerController", "name": "TurnOn", "payloadVersion": "3", "messageId": "m", "correlationToken": "c"}, "endpoint": {"endpointId": "tv"}, "payload": {}}}`
+	out, err := f.Invoke(context.Background(), []byte(event))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Header.Name != "TurnOn" || got.Endpoint.EndpointID != "tv" {
+		t.Errorf("directive = %+v", got)
+	}
+
+	var resp struct {
+		Event struct {
+			Header   Header
+			Endpoint Endpoint
+			Payload  map[string]string
+		}
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		t.Fatal(err)
+	}
+	h := resp.Event.Header
+	if h.Namespace != "Alexa" || h.Name != "ErrorResponse" || h.PayloadVersion != "3" || h.CorrelationToken != "c" || len(h.MessageID) != 32 {
+		t.Errorf("header = %+v", h)
+	}
+	if resp.Event.Endpoint.EndpointID != "tv" || resp.Event.Payload["type"] != ErrorNoSuchEndpoint {
+		t.Errorf("event = %+v", resp.Event)
+	}
+	if strings.Contains(string(out), `"context"`) {
+		t.Error("error responses should not carry a context")
+	}
+
+	if _, err := f.Invoke(context.Background(), []byte(`{"header": {}}`)); err == nil {
+		t.Error("expected error for an event without a directive")
+	}
+}
+
+func TestDirective_ModeErrorResponse(t *testing.T) {
+	d := &Directive{Header: Header{CorrelationToken: "c"}}
+	payload, _ := d.ModeErrorResponse("OTHER", "state unknown").Event.Payload.(map[string]string)
+	if payload["type"] != ErrorNotSupportedInCurrentMode || payload["currentDeviceMode"] != "OTHER" || payload["message"] != "state unknown" {
+		t.Errorf("payload = %+v", payload)
+	}
+}
+
+func TestNewCapability(t *testing.T) {
+	c := NewCapability("Alexa.Speaker", "volume", "muted")
+	if c.Type != "AlexaInterface" || c.Version != "3" || len(c.Properties.Supported) != 2 || !c.Properties.Retrievable {
+		t.Errorf("capability = %+v", c)
+	}
+	if NewCapability("Alexa").Properties != nil {
+		t.Error("expected no properties")
+	}
+}
@@ -0,0 +1,162 @@
+package alexa
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certSubject is the name Amazon's signing certificate must carry.
+const certSubject = "echo-api.amazon.com"
+
+// Verifier checks that requests were signed by Alexa, as described in
+// "Manually verify that the request was sent by Alexa" in the ASK docs.
+// Certificate chains are cached by URL.
+type Verifier struct {
+	// Roots verifies the signing certificate; nil uses the system roots.
+	Roots *x509.CertPool
+	// Fetch downloads a certificate chain; nil uses an HTTP GET.
+	Fetch func(certURL string) ([]byte, error)
+	// Now returns the current time; nil uses time.Now.
+	Now func() time.Time
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+// Verify checks the SignatureCertChainUrl and Signature-256 (or legacy
+// Signature) headers against body.
+func (v *Verifier) Verify(r *http.Request, body []byte) error {
+	certURL := r.Header.Get("SignatureCertChainUrl")
+	if err := verifyCertURL(certURL); err != nil {
+		return err
+	}
+	cert, err := v.cert(certURL)
+	if err != nil {
+		return err
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("alexa: signing certificate key is not RSA")
+	}
+
+	if sig := r.Header.Get("Signature-256"); sig != "" {
+		decoded, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			return fmt.Errorf("alexa: decoding signature: %w", err)
+		}
+		sum := sha256.Sum256(body)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], decoded); err != nil {
+			return errors.New("alexa: signature mismatch")
+		}
+		return nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(r.Header.Get("Signature"))
+	if err != nil || len(decoded) == 0 {
+		return errors.New("alexa: missing signature")
+	}
+	sum := sha1.Sum(body)
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA1, sum[:], decoded); err != nil {
+		return errors.New("alexa: signature mismatch")
+	}
+	return nil
+}
+
+// cert returns the verified signing certificate from certURL.
+func (v *Verifier) cert(certURL string) (*x509.Certificate, error) {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+
+	v.mu.Lock()
+	cert, ok := v.certs[certURL]
+	v.mu.Unlock()
+	if ok && now.After(cert.NotBefore) && now.Before(cert.NotAfter) {
+		return cert, nil
+	}
+
+	fetch := v.Fetch
+	if fetch == nil {
+		fetch = fetchCert
+	}
+	chain, err := fetch(certURL)
+	if err != nil {
+		return nil, fmt.Errorf("alexa: fetching certificate: %w", err)
+	}
+
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(chain); block != nil; block, rest = pem.Decode(rest) {
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("alexa: parsing certificate: %w", err)
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("alexa: no certificate in chain")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       certSubject,
+		Roots:         v.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	}); err != nil {
+		return nil, fmt.Errorf("alexa: invalid certificate: %w", err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.certs == nil {
+		v.certs = make(map[string]*x509.Certificate)
+	}
+	v.certs[certURL] = certs[0]
+	return certs[0], nil
+}
+
+// verifyCertURL checks the certificate chain is hosted by Amazon: https on
+// s3.amazonaws.com, port 443 if any, under /echo.api/.
+func verifyCertURL(certURL string) error {
+	u, err := url.Parse(certURL)
+	if err != nil || certURL == "" {
+		return fmt.Errorf("alexa: invalid certificate URL %q", certURL)
+	}
+	if !strings.EqualFold(u.Scheme, "https") ||
+		!strings.EqualFold(u.Hostname(), "s3.amazonaws.com") ||
+		(u.Port() != "" && u.Port() != "443") ||
+		!strings.HasPrefix(path.Clean(u.Path), "/echo.api/") {
+		return fmt.Errorf("alexa: certificate URL %q is not Amazon's", certURL)
+	}
+	return nil
+}
+
+func fetchCert(certURL string) ([]byte, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(certURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", certURL, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+}
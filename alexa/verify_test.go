@@ -0,0 +1,130 @@
+package alexa
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testChain returns a root pool and a PEM chain whose leaf, signed by the
+// root, is issued to dnsName, along with the leaf's key.
+func testChain(t *testing.T, dnsName string) (*x509.CertPool, []byte, *rsa.PrivateKey) {
+	t.Helper()
+	rootKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := x509.ParseCertificate(rootDER)
+
+	leafKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, root, &leafKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(root)
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})
+	chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER})...)
+	return pool, chain, leafKey
+}
+
+func TestVerifier(t *testing.T) {
+	const certURL = "https://s3.amazonaws.com/echo.api/echo-api-cert.pem"
+	roots, chain, key := testChain(t, certSubject)
+	fetches := 0
+	v := &Verifier{Roots: roots, Fetch: func(string) ([]byte, error) {
+		fetches++
+		return chain, nil
+	}}
+
+	body := []byte(`{"version":"1.0"}`)
+	sum256 := sha256.Sum256(body)
+	sig256, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum256[:])
+	sum1 := sha1.Sum(body)
+	sig1, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, sum1[:])
+
+	request := func(header, sig string) error {
+		r := httptest.NewRequest("POST", "/echo/fr", nil)
+		r.Header.Set("SignatureCertChainUrl", certURL)
+		r.Header.Set(header, sig)
+		return v.Verify(r, body)
+	}
+
+	if err := request("Signature-256", base64.StdEncoding.EncodeToString(sig256)); err != nil {
+		t.Errorf("SHA-256 signature: %v", err)
+	}
+	if err := request("Signature", base64.StdEncoding.EncodeToString(sig1)); err != nil {
+		t.Errorf("SHA-1 signature: %v", err)
+	}
+	if err := request("Signature-256", base64.StdEncoding.EncodeToString(sig1)); err == nil {
+		t.Error("expected mismatched signature to fail")
+	}
+	if err := request("X-Other", "x"); err == nil {
+		t.Error("expected missing signature to fail")
+	}
+	if fetches != 1 {
+		t.Errorf("fetched certificate %d times, want 1", fetches)
+	}
+}
+
+func TestVerifier_RejectsWrongSubject(t *testing.T) {
+	roots, chain, _ := testChain(t, "example.com")
+	v := &Verifier{Roots: roots, Fetch: func(string) ([]byte, error) { return chain, nil }}
+
+	r := httptest.NewRequest("POST", "/echo/fr", nil)
+	r.Header.Set("SignatureCertChainUrl", "https://s3.amazonaws.com/echo.api/echo-api-cert.pem")
+	r.Header.Set("Signature-256", "c2ln")
+	if err := v.Verify(r, nil); err == nil || !strings.Contains(err.Error(), "invalid certificate") {
+		t.Errorf("err = %v, want invalid certificate", err)
+	}
+}
+
+func TestVerifyCertURL(t *testing.T) {
+	for url, ok := range map[string]bool{
+		"https://s3.amazonaws.com/echo.api/echo-api-cert.pem":     true,
+		"https://s3.amazonaws.com:443/echo.api/echo-api-cert.pem": true,
+		"HTTPS://s3.amazonaws.com/echo.api/../echo.api/cert.pem":  true,
+		"http://s3.amazonaws.com/echo.api/echo-api-cert.pem":      false,
+		"https://notamazon.com/echo.api/echo-api-cert.pem":        false,
+		"https://s3.amazonaws.com/EcHo.aPi/echo-api-cert.pem":     false,
+		"https://s3.amazonaws.com/invalid.path/echo-api-cert.pem": false,
+		"https://s3.amazonaws.com:563/echo.api/echo-api-cert.pem": false,
+		"https://s3.amazonaws.com/echo.api/../invalid/cert.pem":   false,
+		"": false,
+	} {
+		if err := verifyCertURL(url); (err == nil) != ok {
+			t.Errorf("verifyCertURL(%q) = %v, want ok %v", url, err, ok)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+// capturedRequest is one line of a capture log: an incoming Alexa request
+// and what the server did with it.
+type capturedRequest struct {
+	Time    time.Time              `json:"time"`
+	Room    string                 `json:"room"`
+	Request *alexa.RequestEnvelope `json:"request"`
+	Speech  string                 `json:"speech"`
+	Calls   []DeviceCall           `json:"calls"`
+}
+
+// CaptureLog appends handled Alexa requests to a JSONL file for replay.
+type CaptureLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// captureLog is the process-wide capture log; nil when capture is disabled.
+var captureLog *CaptureLog
+
+// OpenCaptureLog opens path for appending captured requests.
+func OpenCaptureLog(path string) (*CaptureLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &CaptureLog{file: f}, nil
+}
+
+// Capture writes a request, its speech and its device calls once the
+// request's background device calls have finished.
+func (c *CaptureLog) Capture(room Room, echoReq *alexa.RequestEnvelope, echoResp *alexa.ResponseEnvelope, rc *requestCalls) {
+	rec := capturedRequest{
+		Time:    time.Now(),
+		Room:    room.ID,
+		Request: redact(echoReq),
+		Speech:  speechText(echoResp),
+	}
+	background(context.Background(), func() {
+		rec.Calls = rc.Wait()
+		if err := c.write(rec); err != nil {
+			slog.Error("writing capture log", "err", err)
+		}
+	})
+}
+
+// Close flushes the log to disk and closes it. Captures written afterwards
+// fail and are logged.
+func (c *CaptureLog) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.file.Sync(); err != nil {
+		c.file.Close()
+		return err
+	}
+	return c.file.Close()
+}
+
+func (c *CaptureLog) write(rec capturedRequest) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.file.Write(append(line, '\n'))
+	return err
+}
+
+// redact returns a copy of echoReq without user, device or session credentials.
+func redact(echoReq *alexa.RequestEnvelope) *alexa.RequestEnvelope {
+	r := *echoReq
+	for _, u := range []*alexa.User{&r.Session.User, &r.Context.System.User} {
+		if u.UserID != "" {
+			u.UserID = "redacted"
+		}
+		u.AccessToken = ""
+		u.Permissions = nil
+	}
+	r.Context.System.Person = nil
+	r.Context.System.APIAccessToken = ""
+	if r.Context.System.Device.DeviceID != "" {
+		r.Context.System.Device.DeviceID = "redacted"
+	}
+	return &r
+}
+
+// speechText returns the speech of a response as plain text, if any.
+func speechText(echoResp *alexa.ResponseEnvelope) string {
+	return plainText(echoResp.Speech())
+}
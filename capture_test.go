@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+func TestRedact(t *testing.T) {
+	req := newIntentRequest("OFF", nil)
+	req.Session.User.UserID = "amzn1.ask.account.SECRET"
+	req.Session.User.AccessToken = "token"
+	req.Context.System.Device.DeviceID = "amzn1.ask.device.SECRET"
+	req.Context.System.User.UserID = "amzn1.ask.account.SECRET"
+	req.Context.System.APIAccessToken = "api-token"
+
+	r := redact(req)
+	if r.Session.User.UserID != "redacted" || r.Session.User.AccessToken != "" || r.Context.System.Device.DeviceID != "redacted" {
+		t.Errorf("identifiers not redacted: %+v", r)
+	}
+	if r.Context.System.User.UserID != "redacted" || r.Context.System.APIAccessToken != "" {
+		t.Errorf("context identifiers not redacted: %+v", r.Context.System)
+	}
+	if req.Session.User.UserID != "amzn1.ask.account.SECRET" {
+		t.Error("redact modified the original request")
+	}
+}
+
+func TestCapture_RoundTrip(t *testing.T) {
+	tv := &deviceRecorder{}
+	server := httptest.NewServer(tv)
+	defer server.Close()
+
+	room := testRoom(server.URL, "", "")
+	addRoom(t, room)
+
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	var err error
+	if captureLog, err = OpenCaptureLog(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { captureLog = nil }()
+
+	req := newIntentRequest("Channel", map[string]string{"Number": "9"})
+	req.Session.User.UserID = "amzn1.ask.account.SECRET"
+	handleIntent(room)(req, alexa.NewResponse())
+	pending.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "SECRET") {
+		t.Errorf("capture contains unredacted identifiers: %s", data)
+	}
+	var rec capturedRequest
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Room != "test" || rec.Speech != "Okay." || len(rec.Calls) != 1 {
+		t.Fatalf("unexpected capture: %+v", rec)
+	}
+	if rec.Calls[0].URL != server.URL || rec.Calls[0].Body != `{"command":"Channel","value":"9"}` {
+		t.Errorf("unexpected captured call: %+v", rec.Calls[0])
+	}
+
+	var out bytes.Buffer
+	mismatches, err := replayRecords(bytes.NewReader(data), &out)
+	if err != nil || mismatches != 0 {
+		t.Errorf("replay of fresh capture: %d mismatches, %v\n%s", mismatches, err, out.String())
+	}
+	if len(tv.Calls()) != 1 {
+		t.Errorf("replay contacted the device: %v", tv.Calls())
+	}
+
+	if err := captureLog.Close(); err != nil {
+		t.Errorf("closing capture log: %v", err)
+	}
+	if err := captureLog.write(rec); err == nil {
+		t.Error("expected writes to a closed capture log to fail")
+	}
+}
@@ -2,66 +2,382 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-func executeAction(host string, command string, value string) {
-	log.Println("host:", host)
-	bodyStr := `{"command": "` + command + `"}`
+// DeviceCall is one request made to a device bridge.
+type DeviceCall struct {
+	Time   time.Time `json:"time,omitzero"`
+	Method string    `json:"method"`
+	URL    string    `json:"url"`
+	Body   string    `json:"body"`
+}
+
+var (
+	// dryRun makes send record every device call without sending it, so
+	// intents can be exercised without touching hardware. withDryRun does
+	// the same for a single request.
+	dryRun atomic.Bool
+	// pending tracks device calls running in the background.
+	pending = newCallGroup()
+)
+
+// callSet is the set of device calls currently in flight.
+type callSet struct {
+	mu    sync.Mutex
+	calls map[*DeviceCall]struct{}
+}
+
+// inflight holds the device calls waiting on a response, so shutdown can
+// report the ones it abandons.
+var inflight = &callSet{calls: make(map[*DeviceCall]struct{})}
+
+func (s *callSet) add(c *DeviceCall) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[c] = struct{}{}
+}
+
+func (s *callSet) remove(c *DeviceCall) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.calls, c)
+}
+
+// List returns the calls in flight, oldest first.
+func (s *callSet) List() []DeviceCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]DeviceCall, 0, len(s.calls))
+	for c := range s.calls {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Time.Before(list[j].Time) })
+	return list
+}
+
+// requestCalls collects the device calls made on behalf of one request and
+// tracks the background goroutines making them.
+type requestCalls struct {
+	running *callGroup
+	mu      sync.Mutex
+	started int // background device calls started
+	calls   []DeviceCall
+	updates []func(*RoomState) // state changes the calls make on success
+	err     error
+}
+
+type requestCallsKey struct{}
+
+// withRequestCalls returns a context that collects the device calls made with it.
+func withRequestCalls(ctx context.Context) (context.Context, *requestCalls) {
+	rc := &requestCalls{running: newCallGroup()}
+	return context.WithValue(ctx, requestCallsKey{}, rc), rc
+}
+
+func (rc *requestCalls) start() {
+	rc.running.add()
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.started++
+}
+
+// Started returns how many background device calls the request started.
+func (rc *requestCalls) Started() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.started
+}
+
+func (rc *requestCalls) record(c DeviceCall) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.calls = append(rc.calls, c)
+}
+
+func (rc *requestCalls) expect(update func(*RoomState)) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.updates = append(rc.updates, update)
+}
+
+// Expected returns st as the request's device calls will leave it once they
+// succeed, without waiting for them.
+func (rc *requestCalls) Expected(st RoomState) RoomState {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for _, update := range rc.updates {
+		update(&st)
+	}
+	return st
+}
+
+func (rc *requestCalls) fail(err error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.err == nil {
+		rc.err = err
+	}
+}
+
+// Err returns the first device call error so far, if any.
+func (rc *requestCalls) Err() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.err
+}
+
+// Wait blocks until the request's background device calls finish and
+// returns every call made.
+func (rc *requestCalls) Wait() []DeviceCall {
+	rc.running.Wait()
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]DeviceCall{}, rc.calls...)
+}
+
+// WaitFor blocks until the request's background device calls finish or d
+// passes, whichever is first.
+func (rc *requestCalls) WaitFor(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-rc.running.Idle():
+	case <-timer.C:
+	}
+}
+
+// callGroup counts running goroutines. Unlike a sync.WaitGroup it can be
+// closed, after which it refuses new work, so shutdown can drain it while
+// late requests still try to start device calls.
+type callGroup struct {
+	mu     sync.Mutex
+	n      int
+	closed bool
+	idle   chan struct{} // closed when n drops to zero
+}
+
+func newCallGroup() *callGroup {
+	idle := make(chan struct{})
+	close(idle)
+	return &callGroup{idle: idle}
+}
+
+// add counts one more goroutine, reporting false once the group is closed.
+func (g *callGroup) add() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return false
+	}
+	if g.n == 0 {
+		g.idle = make(chan struct{})
+	}
+	g.n++
+	return true
+}
+
+// done counts one goroutine as finished.
+func (g *callGroup) done() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n--
+	if g.n == 0 {
+		close(g.idle)
+	}
+}
+
+// Close makes the group refuse new work. Running goroutines are unaffected.
+func (g *callGroup) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+}
+
+// Idle returns a channel that is closed once nothing is running.
+func (g *callGroup) Idle() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.idle
+}
+
+// Wait blocks until nothing is running.
+func (g *callGroup) Wait() {
+	<-g.Idle()
+}
+
+// errShuttingDown is returned for device calls started after shutdown began.
+var errShuttingDown = errors.New("shutting down")
+
+// background runs fn in a goroutine tracked by pending and by the
+// request's call collector, if ctx has one. Once shutdown has begun fn is
+// dropped instead.
+func background(ctx context.Context, fn func()) {
+	rc, _ := ctx.Value(requestCallsKey{}).(*requestCalls)
+	if !pending.add() {
+		logger(ctx).Warn("device call dropped", "err", errShuttingDown)
+		if rc != nil {
+			rc.fail(errShuttingDown)
+		}
+		return
+	}
+	if rc != nil {
+		rc.start()
+	}
+	go func() {
+		defer pending.done()
+		if rc != nil {
+			defer rc.running.done()
+		}
+		fn()
+	}()
+}
+
+// goAction runs executeAction in the background.
+func goAction(ctx context.Context, host string, command string, value string) {
+	background(ctx, func() { executeAction(ctx, host, command, value) })
+}
+
+// goReceiver runs updateReceiver in the background.
+func goReceiver(ctx context.Context, host string, update map[string]any) {
+	background(ctx, func() { updateReceiver(ctx, host, update) })
+}
+
+func executeAction(ctx context.Context, host string, command string, value string) error {
+	body := map[string]string{"command": command}
 	if len(value) > 0 {
-		bodyStr = `{"command": "` + command + `", "value": "` + value + `"}`
+		body["value"] = value
+	}
+	return send(ctx, http.MethodPost, host, command, marshalBody(body))
+}
+
+// updateReceiver sends a PUT request to update receiver state. update holds
+// only the properties to change, from "on" (bool), "volume" (dB, int),
+// "input" (string) and "mute" (bool).
+func updateReceiver(ctx context.Context, host string, update map[string]any) error {
+	return send(ctx, http.MethodPut, host, "update", marshalBody(update))
+}
+
+// marshalBody encodes a device request body. Values come from spoken slots,
+// so they are never spliced into JSON by hand.
+func marshalBody(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err) // maps of strings, numbers and bools always encode
+	}
+	return string(b)
+}
+
+// send issues a JSON request to a device bridge. Non-2xx responses are
+// errors. command labels the call in metrics.
+func send(ctx context.Context, method string, host string, command string, bodyStr string) (err error) {
+	if host == "" {
+		logger(ctx).Warn("device call skipped: no device configured", "command", command)
+		return errNoDevice
+	}
+	roomID, kind := hostDevice(host)
+	ctx, span := startSpan(ctx, method+" "+kind, spanClient, "room", roomID, "device", kind, "command", command, "url", host)
+	defer span.End()
+	log := logger(ctx).With("method", method, "url", host)
+	call := DeviceCall{Method: method, URL: host, Body: bodyStr}
+	if rc, ok := ctx.Value(requestCallsKey{}).(*requestCalls); ok {
+		rc.record(call)
+		defer func() {
+			if err != nil {
+				rc.fail(err)
+			}
+		}()
+	}
+	if calls := dryRunLog(ctx); calls != nil {
+		log.Info("device call (dry run)", "body", bodyStr)
+		call.Time = time.Now()
+		calls.Record(call)
+		recordDryRunCall(host, command)
+		span.SetAttr("status", "dry_run")
+		return nil
 	}
-	log.Println("body: ", bodyStr)
 
-	req, err := http.NewRequest("POST", host, bytes.NewBuffer([]byte(bodyStr)))
+	req, err := http.NewRequest(method, host, bytes.NewBuffer([]byte(bodyStr)))
 	if err != nil {
-		log.Println(err)
-		return
+		log.Error("device call failed", "body", bodyStr, "err", err)
+		span.SetError(err)
+		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if span != nil {
+		req.Header.Set("traceparent", span.traceparent())
+	}
 
+	start := time.Now()
+	current := &DeviceCall{Time: start, Method: method, URL: host, Body: bodyStr}
+	inflight.add(current)
+	defer inflight.remove(current)
 	client := &http.Client{Timeout: 15 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println(err)
-		return
+		recordDeviceCall(host, command, 0, time.Since(start))
+		log.Error("device call failed", "body", bodyStr, "err", err)
+		span.SetAttr("status", "error")
+		span.SetError(err)
+		return err
 	}
 	defer resp.Body.Close()
+	recordDeviceCall(host, command, resp.StatusCode, time.Since(start))
+	span.SetAttr("status", resp.StatusCode)
 
-	log.Println("response Status:", resp.Status)
-	fmt.Println("response Headers:", resp.Header)
 	body, _ := io.ReadAll(resp.Body)
-	fmt.Println("response Body:", string(body))
+	log.Debug("device response", "headers", resp.Header, "response_body", string(body))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Error("device call failed", "body", bodyStr, "status", resp.StatusCode, "duration", time.Since(start))
+		err := fmt.Errorf("%s %s: %s", method, host, resp.Status)
+		span.SetError(err)
+		return err
+	}
+	log.Info("device call", "body", bodyStr, "status", resp.StatusCode, "duration", time.Since(start))
+	return nil
 }
 
-// updateReceiver sends a PUT request to update receiver state.
-// Body string should look like: {"on": true, "volume": "string", "input": "string", "mute": true}
-// but should only include the properties that need to be updated.
-func updateReceiver(host string, bodyStr string) {
-	log.Println("host:", host)
-	log.Println("body: ", bodyStr)
+// errNoDevice is returned for calls to a device the room doesn't have.
+var errNoDevice = errors.New("no device configured")
 
-	req, err := http.NewRequest(http.MethodPut, host, bytes.NewBuffer([]byte(bodyStr)))
-	if err != nil {
-		log.Println(err)
-		return
+// errDryRun is returned by reads that dry-run mode keeps from reaching a device.
+var errDryRun = errors.New("dry run: device not contacted")
+
+// receiverStatus is the state reported by a GET on the receiver bridge.
+type receiverStatus struct {
+	On     bool        `json:"on"`
+	Volume json.Number `json:"volume"`
+	Input  string      `json:"input"`
+	Mute   bool        `json:"mute"`
+}
+
+// getReceiver fetches the current receiver state.
+func getReceiver(host string) (receiverStatus, error) {
+	var status receiverStatus
+	if dryRun.Load() {
+		return status, errDryRun
 	}
-	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := client.Get(host)
 	if err != nil {
-		log.Println(err)
-		return
+		return status, err
 	}
 	defer resp.Body.Close()
 
-	log.Println("response Status:", resp.Status)
-	fmt.Println("response Headers:", resp.Header)
-	body, _ := io.ReadAll(resp.Body)
-	fmt.Println("response Body:", string(body))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return status, fmt.Errorf("GET %s: %s", host, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	return status, err
 }
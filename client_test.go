@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -19,7 +21,7 @@ func TestExecuteAction_NoValue(t *testing.T) {
 	}))
 	defer server.Close()
 
-	executeAction(server.URL, "PowerOff", "")
+	executeAction(context.Background(), server.URL, "PowerOff", "")
 
 	if receivedMethod != "POST" {
 		t.Errorf("expected POST, got %s", receivedMethod)
@@ -27,7 +29,7 @@ func TestExecuteAction_NoValue(t *testing.T) {
 	if receivedContentType != "application/json" {
 		t.Errorf("expected application/json, got %s", receivedContentType)
 	}
-	expected := `{"command": "PowerOff"}`
+	expected := `{"command":"PowerOff"}`
 	if receivedBody != expected {
 		t.Errorf("expected body %q, got %q", expected, receivedBody)
 	}
@@ -42,17 +44,40 @@ func TestExecuteAction_WithValue(t *testing.T) {
 	}))
 	defer server.Close()
 
-	executeAction(server.URL, "Channel", "42")
+	executeAction(context.Background(), server.URL, "Channel", "42")
 
-	expected := `{"command": "Channel", "value": "42"}`
+	expected := `{"command":"Channel","value":"42"}`
 	if receivedBody != expected {
 		t.Errorf("expected body %q, got %q", expected, receivedBody)
 	}
 }
 
+func TestExecuteAction_EscapesValue(t *testing.T) {
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("body is not JSON: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	value := `news", "command": "PowerOff`
+	executeAction(context.Background(), server.URL, "search", value)
+
+	if received["command"] != "search" || received["value"] != value {
+		t.Errorf("unexpected body %v", received)
+	}
+}
+
 func TestExecuteAction_ServerDown(t *testing.T) {
 	// Should log error but not panic/fatal
-	executeAction("http://127.0.0.1:1", "PowerOff", "")
+	executeAction(context.Background(), "http://127.0.0.1:1", "PowerOff", "")
+}
+
+func TestExecuteAction_NoHost(t *testing.T) {
+	if err := executeAction(context.Background(), "", "home", ""); err != errNoDevice {
+		t.Errorf("expected errNoDevice, got %v", err)
+	}
 }
 
 func TestUpdateReceiver(t *testing.T) {
@@ -66,8 +91,7 @@ func TestUpdateReceiver(t *testing.T) {
 	}))
 	defer server.Close()
 
-	payload := `{"on": false}`
-	updateReceiver(server.URL, payload)
+	updateReceiver(context.Background(), server.URL, map[string]any{"on": false})
 
 	if receivedMethod != http.MethodPut {
 		t.Errorf("expected PUT, got %s", receivedMethod)
@@ -75,14 +99,14 @@ func TestUpdateReceiver(t *testing.T) {
 	if receivedContentType != "application/json" {
 		t.Errorf("expected application/json, got %s", receivedContentType)
 	}
-	if receivedBody != payload {
-		t.Errorf("expected body %q, got %q", payload, receivedBody)
+	if receivedBody != `{"on":false}` {
+		t.Errorf("expected body %q, got %q", `{"on":false}`, receivedBody)
 	}
 }
 
 func TestUpdateReceiver_ServerDown(t *testing.T) {
 	// Should log error but not panic/fatal
-	updateReceiver("http://127.0.0.1:1", `{"on": false}`)
+	updateReceiver(context.Background(), "http://127.0.0.1:1", map[string]any{"on": false})
 }
 
 func TestUpdateReceiver_MutePayload(t *testing.T) {
@@ -94,9 +118,23 @@ func TestUpdateReceiver_MutePayload(t *testing.T) {
 	}))
 	defer server.Close()
 
-	updateReceiver(server.URL, `{"mute": true}`)
+	updateReceiver(context.Background(), server.URL, map[string]any{"mute": true})
 
-	if !strings.Contains(receivedBody, `"mute": true`) {
+	if !strings.Contains(receivedBody, `"mute":true`) {
 		t.Errorf("expected mute payload, got %q", receivedBody)
 	}
 }
+
+func TestExecuteAction_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	if err := executeAction(context.Background(), server.URL, "PowerOff", ""); err == nil {
+		t.Error("expected error for non-2xx response")
+	}
+	if err := updateReceiver(context.Background(), server.URL, map[string]any{"on": false}); err == nil {
+		t.Error("expected error for non-2xx response")
+	}
+}
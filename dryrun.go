@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// dryRunLimit is how many dry-run device calls are kept for inspection.
+const dryRunLimit = 500
+
+// dryRunFromEnv reports whether DRY_RUN asks for dry-run mode. It is the
+// default of every --dry-run flag, so a deployment set up to send nothing
+// stays that way in its subcommands too.
+func dryRunFromEnv() bool {
+	on, _ := strconv.ParseBool(os.Getenv("DRY_RUN"))
+	return on
+}
+
+// CallLog keeps the most recent device calls.
+type CallLog struct {
+	mu    sync.Mutex
+	limit int
+	calls []DeviceCall
+}
+
+// dryRunCalls holds the calls recorded while dry-run mode is on.
+var dryRunCalls = NewCallLog(dryRunLimit)
+
+// NewCallLog returns a log keeping at most limit calls.
+func NewCallLog(limit int) *CallLog {
+	return &CallLog{limit: limit}
+}
+
+// Record appends a call, dropping the oldest once the limit is reached.
+func (l *CallLog) Record(c DeviceCall) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, c)
+	if len(l.calls) > l.limit {
+		l.calls = l.calls[len(l.calls)-l.limit:]
+	}
+}
+
+// Calls returns the recorded calls, oldest first.
+func (l *CallLog) Calls() []DeviceCall {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]DeviceCall{}, l.calls...)
+}
+
+// Reset discards all recorded calls.
+func (l *CallLog) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = nil
+}
+
+// dryRunKey is the context key for a request's dry-run call log.
+type dryRunKey struct{}
+
+// withDryRun returns a context whose device calls are recorded in calls
+// instead of being sent. Other requests are unaffected.
+func withDryRun(ctx context.Context, calls *CallLog) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, calls)
+}
+
+// dryRunLog returns the log ctx's device calls are recorded in instead of
+// being sent, or nil if they are sent. In dry-run mode that is dryRunCalls.
+func dryRunLog(ctx context.Context) *CallLog {
+	if calls, ok := ctx.Value(dryRunKey{}).(*CallLog); ok {
+		return calls
+	}
+	if dryRun.Load() {
+		return dryRunCalls
+	}
+	return nil
+}
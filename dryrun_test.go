@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestCallLog_Bounded(t *testing.T) {
+	l := NewCallLog(2)
+	l.Record(DeviceCall{Body: "1"})
+	l.Record(DeviceCall{Body: "2"})
+	l.Record(DeviceCall{Body: "3"})
+
+	calls := l.Calls()
+	if len(calls) != 2 || calls[0].Body != "2" || calls[1].Body != "3" {
+		t.Errorf("unexpected calls: %+v", calls)
+	}
+
+	l.Reset()
+	if len(l.Calls()) != 0 {
+		t.Error("expected empty log after reset")
+	}
+}
+
+func TestDryRun_RecordsWithoutSending(t *testing.T) {
+	hit := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	dryRun.Store(true)
+	dryRunCalls.Reset()
+	defer dryRun.Store(false)
+
+	if err := executeAction(context.Background(), server.URL, "PowerOff", ""); err != nil {
+		t.Errorf("expected dry-run call to succeed, got %v", err)
+	}
+	if err := updateReceiver(context.Background(), server.URL, map[string]any{"on": false}); err != nil {
+		t.Errorf("expected dry-run call to succeed, got %v", err)
+	}
+	if _, err := getReceiver(server.URL); err != errDryRun {
+		t.Errorf("expected errDryRun from getReceiver, got %v", err)
+	}
+	if hit {
+		t.Error("dry-run mode contacted the device")
+	}
+
+	calls := dryRunCalls.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 recorded calls, got %d", len(calls))
+	}
+	if calls[0].Method != http.MethodPost || calls[0].URL != server.URL || calls[0].Body != `{"command":"PowerOff"}` {
+		t.Errorf("unexpected first call: %+v", calls[0])
+	}
+	if calls[1].Method != http.MethodPut || calls[1].Time.IsZero() {
+		t.Errorf("unexpected second call: %+v", calls[1])
+	}
+}
+
+func TestWithDryRun_OnlyThatRequest(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, string(body))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	calls := NewCallLog(dryRunLimit)
+	dryCtx := withDryRun(context.Background(), calls)
+	if err := executeAction(dryCtx, server.URL, "PowerOff", ""); err != nil {
+		t.Errorf("expected dry-run call to succeed, got %v", err)
+	}
+	if err := executeAction(context.Background(), server.URL, "PowerOn", ""); err != nil {
+		t.Errorf("live call failed: %v", err)
+	}
+
+	if recorded := calls.Calls(); len(recorded) != 1 || recorded[0].Body != `{"command":"PowerOff"}` {
+		t.Errorf("unexpected recorded calls: %+v", recorded)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 1 || got[0] != `{"command":"PowerOn"}` {
+		t.Errorf("expected only the live call to reach the device, got %v", got)
+	}
+}
+
+func TestAdmin_DryRunCalls(t *testing.T) {
+	dryRunCalls.Reset()
+	dryRunCalls.Record(DeviceCall{Method: http.MethodPost, URL: "http://tv", Body: `{"command":"Mute"}`})
+	h := newAdminHandler("secret")
+
+	rec := adminRequest(t, h, http.MethodGet, "/dry-run/calls", "")
+	var got struct {
+		Calls []DeviceCall `json:"calls"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	if len(got.Calls) != 1 || got.Calls[0].URL != "http://tv" {
+		t.Errorf("unexpected calls: %s", rec.Body)
+	}
+
+	rec = adminRequest(t, h, http.MethodDelete, "/dry-run/calls", "")
+	if rec.Code != http.StatusNoContent || len(dryRunCalls.Calls()) != 0 {
+		t.Errorf("expected calls cleared, got %d and %d calls", rec.Code, len(dryRunCalls.Calls()))
+	}
+}
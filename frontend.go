@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Frontend is a protocol rooms are served over, such as an Alexa custom
+// skill or the generic webhook. Each translates its requests into
+// IntentRequests for serveIntent, so every front-end shares the same intent
+// semantics.
+type Frontend interface {
+	// Routes returns the front-end's handlers by ServeMux pattern.
+	Routes() map[string]http.Handler
+}
+
+// errNoSlot is returned for a slot that is missing or empty.
+var errNoSlot = errors.New("slot not provided")
+
+// IntentRequest is a command for a room as every front-end delivers it:
+// an intent and its slot values, with nothing specific to one protocol.
+type IntentRequest struct {
+	ID     string            // request ID for logs and traces, if the front-end has one
+	Intent string            // intent name, in any case
+	Slots  map[string]string // slot values as said
+	// Progress, if set, tells the user something while a long command
+	// runs. The returned channel is closed once the message is delivered.
+	Progress func(ctx context.Context, speech string) <-chan struct{}
+}
+
+// Slot returns a slot's value, or errNoSlot if it is missing or empty.
+func (r *IntentRequest) Slot(name string) (string, error) {
+	if v := r.Slots[name]; v != "" {
+		return v, nil
+	}
+	return "", errNoSlot
+}
+
+// progress sends speech through Progress, if the front-end supports it.
+func (r *IntentRequest) progress(ctx context.Context, speech string) <-chan struct{} {
+	if r.Progress == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return r.Progress(ctx, speech)
+}
+
+// IntentResponse is serveIntent's reply.
+type IntentResponse struct {
+	Speech   string // SSML
+	Reprompt string // plain text to say if the user doesn't answer, or "" to end the conversation
+	Outcome  string // outcomeOK, outcomeRefused or outcomeError, as reported in metrics
+}
+
+// Text returns the reply without SSML markup.
+func (r IntentResponse) Text() string {
+	return plainText(r.Speech)
+}
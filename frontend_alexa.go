@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+// alexaSkills is the Alexa custom skill front-end: one skill per room, by
+// endpoint path.
+type alexaSkills map[string]*alexa.Skill
+
+func (s alexaSkills) Routes() map[string]http.Handler {
+	routes := make(map[string]http.Handler, len(s))
+	for path, skill := range s {
+		routes["POST "+path] = skill
+	}
+	return routes
+}
+
+// roomSkill returns the custom skill for a room.
+func roomSkill(appID string, room Room) *alexa.Skill {
+	return alexa.NewSkill(appID).
+		Handle(alexa.TypeLaunch, handleIntent(room)).
+		Handle(alexa.TypeIntent, handleIntent(room)).
+		Handle(alexa.TypeAPLUserEvent, handleUserEvent(room))
+}
+
+// handleIntent returns an Alexa intent handler for the given room.
+func handleIntent(room Room) func(*alexa.RequestEnvelope, *alexa.ResponseEnvelope) {
+	return func(echoReq *alexa.RequestEnvelope, echoResp *alexa.ResponseEnvelope) {
+		answerIntent(room, echoReq, echoResp)
+	}
+}
+
+// answerIntent serves an Alexa request for the room into echoResp and
+// returns serveIntent's reply.
+func answerIntent(room Room, echoReq *alexa.RequestEnvelope, echoResp *alexa.ResponseEnvelope) IntentResponse {
+	ctx, rc := withRequestCalls(context.Background())
+	resp := serveIntent(ctx, room, alexaIntentRequest(echoReq))
+	echoResp.OutputSpeechSSML(resp.Speech)
+	if resp.Reprompt != "" {
+		echoResp.Reprompt(resp.Reprompt)
+	}
+	if text := resp.Text(); text != "" {
+		echoResp.SimpleCard(room.Name, text)
+	}
+	if hasScreen(echoReq) {
+		// Show the state the intent is leaving the room in rather than
+		// holding the reply until its device calls finish.
+		renderRoom(room, rc.Expected(states.Get(room.ID)), echoResp)
+	}
+	if captureLog != nil {
+		captureLog.Capture(room, echoReq, echoResp, rc)
+	}
+	return resp
+}
+
+// handleUserEvent returns a handler for touches on the room document. Each
+// runs as the intent it stands for. Successful taps answer silently; ones
+// the room refused or failed are spoken, going by the intent's outcome.
+func handleUserEvent(room Room) func(*alexa.RequestEnvelope, *alexa.ResponseEnvelope) {
+	return func(echoReq *alexa.RequestEnvelope, echoResp *alexa.ResponseEnvelope) {
+		intent, ok := eventIntent(echoReq)
+		if !ok {
+			slog.Warn("unknown touch event", "room", room.ID, "arguments", echoReq.Request.Arguments)
+			renderRoom(room, states.Get(room.ID), echoResp)
+			return
+		}
+		req := *echoReq
+		req.Request.Intent = intent
+		if answerIntent(room, &req, echoResp).Outcome == outcomeOK {
+			echoResp.Response.OutputSpeech = nil
+		}
+	}
+}
+
+// alexaIntentRequest converts an Alexa request for serveIntent. Progress
+// messages go out as progressive responses.
+func alexaIntentRequest(echoReq *alexa.RequestEnvelope) *IntentRequest {
+	return &IntentRequest{
+		ID:     echoReq.Request.RequestID,
+		Intent: echoReq.IntentName(),
+		Slots:  slotValues(echoReq),
+		Progress: func(ctx context.Context, speech string) <-chan struct{} {
+			return sendProgressive(ctx, echoReq, speech)
+		},
+	}
+}
+
+// slotValues flattens a request's slots to name/value pairs.
+func slotValues(echoReq *alexa.RequestEnvelope) map[string]string {
+	slots := echoReq.Slots()
+	if len(slots) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(slots))
+	for name, slot := range slots {
+		values[name] = slot.Value
+	}
+	return values
+}
+
+// newIntentRequest builds an IntentRequest envelope like the ones Alexa sends.
+func newIntentRequest(intent string, slots map[string]string) *alexa.RequestEnvelope {
+	req := &alexa.RequestEnvelope{Version: "1.0"}
+	req.Request.Type = "IntentRequest"
+	req.Request.Intent.Name = intent
+	req.Request.Intent.Slots = make(map[string]alexa.Slot, len(slots))
+	for name, value := range slots {
+		req.Request.Intent.Slots[name] = alexa.Slot{Name: name, Value: value}
+	}
+	return req
+}
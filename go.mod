@@ -1,10 +1,3 @@
 module github.com/terickson/go-alexa-api
 
 go 1.25
-
-require github.com/mikeflynn/go-alexa v0.0.0-20211022155346-6d20dc2c7771
-
-require (
-	github.com/gorilla/mux v1.8.0 // indirect
-	github.com/urfave/negroni v1.0.0 // indirect
-)
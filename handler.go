@@ -1,102 +1,219 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"strconv"
 	"strings"
+	"time"
+)
 
-	alexa "github.com/mikeflynn/go-alexa/skillserver"
+// serveIntent handles one request for a room from any front-end. Device
+// calls made with ctx run in the background after it returns.
+func serveIntent(ctx context.Context, room Room, req *IntentRequest) IntentResponse {
+	intent := strings.ToUpper(req.Intent)
+	spec, known := intents.Lookup(intent)
+	if known {
+		intent = spec.Name
+	}
+	ctx, span := startSpan(ctx, "intent "+intent, spanServer, "room", room.ID, "intent", intent, "request_id", req.ID)
+	defer span.End()
+	ctx = withLogger(ctx, "request_id", req.ID, "room", room.ID, "intent", intent)
+	if span != nil {
+		ctx = withLogger(ctx, "trace_id", span.TraceID)
+	}
+	logger(ctx).Info("intent received", "slots", req.Slots)
+	out, reprompt := sorry(intent), ""
+	if known {
+		out, reprompt = spec.run(ctx, room, req)
+	}
+
+	// Intent names come from the caller, so unknown ones share one series.
+	metricIntent := intent
+	if !known {
+		metricIntent = "unknown"
+	}
+	intentsTotal.Add(1, room.ID, metricIntent, out.Outcome)
+	span.SetAttr("outcome", out.Outcome)
+	speech := responses.Render(room, intent, out, responseVarsFor(room, intent, req, out))
+	commands.Record(room.ID, Command{
+		Time:   time.Now(),
+		Intent: intent,
+		Slots:  req.Slots,
+		Speech: plainText(speech),
+	})
+	return IntentResponse{Speech: speech, Reprompt: reprompt, Outcome: out.Outcome}
+}
+
+// Intent outcomes, as reported in metrics and IntentResponse.
+const (
+	outcomeOK      = "ok"      // carried out, or nothing needed doing
+	outcomeRefused = "refused" // left alone, such as when the room's state is unknown
+	outcomeError   = "error"   // failed, or the request couldn't be used
 )
 
-// handleIntent returns an Alexa intent handler for the given room.
-func handleIntent(room Room) func(*alexa.EchoRequest, *alexa.EchoResponse) {
-	return func(echoReq *alexa.EchoRequest, echoResp *alexa.EchoResponse) {
-		intent := strings.ToUpper(echoReq.GetIntentName())
-		fmt.Println("Intent passed: " + intent)
-		output := "Processing Request."
-
-		switch intent {
-		case "OFF":
-			go executeAction(room.TVActionHost, "PowerOff", "")
-			if room.ReceiverHost != "" {
-				go updateReceiver(room.ReceiverHost, `{"on": false}`)
-			}
-		case "MUTE":
-			if room.ReceiverHost != "" {
-				go updateReceiver(room.ReceiverHost, `{"mute": true}`)
-			} else {
-				go executeAction(room.TVActionHost, "Mute", "")
-			}
-		case "UNMUTE":
-			if room.ReceiverHost != "" {
-				go updateReceiver(room.ReceiverHost, `{"mute": false}`)
-			}
-		case "VOLUME":
-			slotLevel, err := echoReq.GetSlotValue("Level")
-			if err != nil {
-				log.Println(err)
-				output = "I'm sorry I could not process your request " + intent + "."
-			} else {
-				if room.ReceiverHost != "" {
-					go updateReceiver(room.ReceiverHost, `{"volume": -`+slotLevel+`}`)
-				} else {
-					go executeAction(room.TVActionHost, "Volume", slotLevel)
-				}
-			}
-		case "CHANNEL":
-			slotNumber, err := echoReq.GetSlotValue("Number")
-			if err != nil {
-				log.Println(err)
-				output = "I'm sorry I could not process your request " + intent + "."
-			} else {
-				go executeAction(room.TVActionHost, "Channel", slotNumber)
-			}
-		case "CHANNELUP":
-			go executeAction(room.TVActionHost, "ChannelUp", "")
-		case "CHANNELDOWN":
-			go executeAction(room.TVActionHost, "ChannelDown", "")
-		case "INPUT":
-			slotInputType, err := echoReq.GetSlotValue("InputType")
-			if err != nil {
-				log.Println(err)
-				output = "I'm sorry I could not process your request " + intent + "."
-			} else {
-				inputType := strings.ReplaceAll(strings.ToUpper(slotInputType), " ", "")
-				setInput(room, inputType)
-			}
-		case "HOME":
-			go executeAction(room.RokuActionHost, "home", "")
-		case "BACK":
-			go executeAction(room.RokuActionHost, "back", "")
-		case "UP", "DOWN", "LEFT", "RIGHT":
-			spaces := "1"
-			slotSpaces, err := echoReq.GetSlotValue("Spaces")
-			if err == nil && len(slotSpaces) > 0 {
-				spaces = slotSpaces
-			}
-			go executeAction(room.RokuActionHost, strings.ToLower(intent), spaces)
-		case "ENTER":
-			go executeAction(room.RokuActionHost, "enter", "")
-		case "SELECT":
-			go executeAction(room.RokuActionHost, "select", "")
-		case "PLAY":
-			go executeAction(room.RokuActionHost, "right", "")
-		case "FORWARD":
-			go executeAction(room.RokuActionHost, "forward", "")
-		case "REVERSE":
-			go executeAction(room.RokuActionHost, "reverse", "")
-		case "SEARCH":
-			slotSearchType, err := echoReq.GetSlotValue("SearchType")
-			if err != nil {
-				log.Println(err)
-				output = "I'm sorry I could not process your request " + intent + "."
-			} else {
-				go executeAction(room.RokuActionHost, "search", slotSearchType)
-			}
-		default:
-			output = "I'm sorry I could not process your request " + intent + "."
-		}
-
-		echoResp.OutputSpeech(output)
+// reply is a handler's answer: what to say, if anything beyond the ok
+// template, and how the intent went.
+type reply struct {
+	Text    string
+	Outcome string
+}
+
+// info is a successful reply with something to report.
+func info(text string) reply {
+	return reply{Text: text, Outcome: outcomeOK}
+}
+
+// refused is the reply for an intent left alone on purpose.
+func refused(text string) reply {
+	return reply{Text: text, Outcome: outcomeRefused}
+}
+
+// failed is the reply for an intent that could not be carried out.
+func failed(text string) reply {
+	return reply{Text: text, Outcome: outcomeError}
+}
+
+// switchInput switches the room to the InputType slot, telling the user
+// while the TV warms up.
+func switchInput(ctx context.Context, room Room, req *IntentRequest) reply {
+	said, _ := req.Slot("InputType")
+	inputType := aliasKey(said)
+	sent := req.progress(ctx, "Switching the "+strings.ToLower(room.Name)+" to "+inputName(room, inputType, said)+"…")
+	setInput(ctx, room, inputType, "")
+	<-sent
+	return acknowledged
+}
+
+// tuneChannel changes to the Number slot: a channel number, or a name from
+// the room's lineup. A lineup channel on another input switches to it
+// first, unless the room is already on that input.
+func tuneChannel(ctx context.Context, room Room, req *IntentRequest) reply {
+	value, _ := req.Slot("Number")
+	ch, named := room.Channels[value]
+	if !named {
+		goAction(ctx, room.TVActionHost, "Channel", value)
+		return acknowledged
+	}
+	if st := states.Get(room.ID); ch.Input != "" && (!st.Power || st.Input != ch.Input) {
+		sent := req.progress(ctx, "Switching the "+strings.ToLower(room.Name)+" to "+inputName(room, ch.Input, ch.Input)+"…")
+		setInput(ctx, room, ch.Input, ch.Number)
+		<-sent
+		return acknowledged
+	}
+	goAction(ctx, room.TVActionHost, "Channel", ch.Number)
+	return acknowledged
+}
+
+// setVolume sets the room's volume on the receiver if present, else the TV.
+func setVolume(ctx context.Context, room Room, level string) {
+	n, err := strconv.Atoi(level)
+	if err != nil {
+		logger(ctx).Warn("invalid volume level", "level", level)
+		return
+	}
+	update := func(s *RoomState) {
+		s.Volume = n
+		s.VolumeKnown = true
+		s.Muted = false
+		s.MuteKnown = true
+	}
+	if room.ReceiverHost != "" {
+		track(ctx, room, func() error { return updateReceiver(ctx, room.ReceiverHost, map[string]any{"volume": -n}) }, update)
+	} else {
+		track(ctx, room, func() error { return executeAction(ctx, room.TVActionHost, "Volume", level) }, update)
+	}
+}
+
+// changeVolume raises or lowers the volume by the Amount slot (default 5)
+// relative to the tracked volume.
+func changeVolume(ctx context.Context, room Room, req *IntentRequest, up bool) reply {
+	st := states.Get(room.ID)
+	if !st.VolumeKnown {
+		return refused("I don't know the current volume in the " + room.Name + ".")
+	}
+
+	step := 5
+	if slotAmount, err := req.Slot("Amount"); err == nil {
+		step, _ = strconv.Atoi(slotAmount)
+	}
+
+	// Receiver levels are attenuation, so louder means a smaller number.
+	if room.ReceiverHost != "" {
+		step = -step
+	}
+	if !up {
+		step = -step
+	}
+	level := st.Volume + step
+	if level < 0 {
+		level = 0
+	}
+	setVolume(ctx, room, strconv.Itoa(level))
+	return acknowledged
+}
+
+// setSleepTimer schedules the room to power off after the Duration slot.
+func setSleepTimer(ctx context.Context, room Room, req *IntentRequest) reply {
+	slotDuration, _ := req.Slot("Duration")
+	d, err := parseISODuration(slotDuration)
+	if err != nil || d <= 0 || scheduler == nil {
+		logger(ctx).Warn("invalid sleep timer", "duration", slotDuration, "err", err)
+		return sorry("SLEEPTIMER")
+	}
+	if _, err := scheduler.SetSleepTimer(room.ID, d); err != nil {
+		logger(ctx).Error("setting sleep timer", "err", err)
+		return sorry("SLEEPTIMER")
+	}
+	return info(fmt.Sprintf("The %s will turn off in %s.", room.Name, formatDuration(d)))
+}
+
+// sleepTimerLeft reports the time remaining on the room's sleep timer.
+func sleepTimerLeft(room Room) reply {
+	if scheduler == nil {
+		return info("There is no sleep timer set for the " + room.Name + ".")
+	}
+	sched, ok := scheduler.SleepTimer(room.ID)
+	if !ok {
+		return info("There is no sleep timer set for the " + room.Name + ".")
+	}
+	return info(fmt.Sprintf("The %s will turn off in %s.", room.Name, formatDuration(scheduler.Remaining(sched))))
+}
+
+// addSchedule adds a recurring power-off from the Time and Days slots.
+func addSchedule(ctx context.Context, room Room, req *IntentRequest) reply {
+	slotTime, _ := req.Slot("Time")
+	slotDays, _ := req.Slot("Days")
+	days, err := parseDays(slotDays)
+	if err != nil || scheduler == nil {
+		logger(ctx).Warn("invalid schedule", "days", slotDays, "err", err)
+		return sorry("SCHEDULE")
+	}
+	sched, err := scheduler.AddRecurring(room.ID, days, slotTime)
+	if err != nil {
+		logger(ctx).Error("adding schedule", "time", slotTime, "err", err)
+		return sorry("SCHEDULE")
+	}
+	return info(fmt.Sprintf("The %s will turn off %s at %s.", room.Name, describeDays(days), sched.At.Format("3:04 PM")))
+}
+
+// cancelSchedules removes the room's sleep timer or recurring schedules.
+func cancelSchedules(ctx context.Context, room Room, recurring bool) reply {
+	none := "There is no sleep timer set for the " + room.Name + "."
+	done := "Cancelled the " + room.Name + " sleep timer."
+	if recurring {
+		none = "There are no schedules set for the " + room.Name + "."
+		done = "Cancelled the " + room.Name + " schedules."
+	}
+	if scheduler == nil {
+		return info(none)
+	}
+	n, err := scheduler.Cancel(room.ID, recurring)
+	if err != nil {
+		logger(ctx).Error("saving schedules", "err", err)
+	}
+	if n == 0 {
+		return info(none)
 	}
+	return info(done)
 }
@@ -4,28 +4,33 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
-	"time"
 
-	alexa "github.com/mikeflynn/go-alexa/skillserver"
+	"github.com/terickson/go-alexa-api/alexa"
 )
 
-func newEchoRequest(intentName string, slots map[string]string) *alexa.EchoRequest {
-	req := &alexa.EchoRequest{}
+func newEchoRequest(intentName string, slots map[string]string) *alexa.RequestEnvelope {
+	req := &alexa.RequestEnvelope{}
 	req.Request.Type = "IntentRequest"
 	req.Request.Intent.Name = intentName
 	if len(slots) > 0 {
-		req.Request.Intent.Slots = make(map[string]alexa.EchoSlot)
+		req.Request.Intent.Slots = make(map[string]alexa.Slot)
 		for k, v := range slots {
-			req.Request.Intent.Slots[k] = alexa.EchoSlot{Name: k, Value: v}
+			req.Request.Intent.Slots[k] = alexa.Slot{Name: k, Value: v}
 		}
 	}
 	return req
 }
 
+// testRoom returns a room pointed at the given fake devices. Tracked state is
+// reset so each test starts from an unknown room.
 func testRoom(tvURL, rokuURL, receiverURL string) Room {
+	resetState()
 	return Room{
+		ID:             "test",
 		Name:           "Test Room",
 		TVActionHost:   tvURL,
 		RokuActionHost: rokuURL,
@@ -35,9 +40,29 @@ func testRoom(tvURL, rokuURL, receiverURL string) Room {
 			"NETFLIX": {ReceiverInput: "HDMI1", TVInput: "HDMI1", RokuApp: "Netflix"},
 			"TV":      {ReceiverInput: "AV1", TVInput: "InputTV"},
 		},
+		Capabilities: Capabilities{TVDiscretePower: true},
 	}
 }
 
+// resetState forgets all tracked state. Background calls left by earlier
+// tests are drained first so none of them sees the swap.
+func resetState() {
+	pending.Wait()
+	states = NewStateStore()
+}
+
+// addRoom registers room for the rest of the test. Background calls look
+// rooms up, so they are drained before it is removed.
+func addRoom(t *testing.T, room Room) {
+	t.Helper()
+	pending.Wait()
+	Rooms[room.ID] = room
+	t.Cleanup(func() {
+		pending.Wait()
+		delete(Rooms, room.ID)
+	})
+}
+
 func TestHandleIntent_OFF_WithReceiver(t *testing.T) {
 	var mu sync.Mutex
 	var tvCalls, receiverCalls []string
@@ -62,10 +87,10 @@ func TestHandleIntent_OFF_WithReceiver(t *testing.T) {
 	handler := handleIntent(room)
 
 	req := newEchoRequest("OFF", nil)
-	resp := alexa.NewEchoResponse()
+	resp := alexa.NewResponse()
 	handler(req, resp)
 
-	time.Sleep(100 * time.Millisecond)
+	pending.Wait()
 
 	mu.Lock()
 	defer mu.Unlock()
@@ -73,13 +98,13 @@ func TestHandleIntent_OFF_WithReceiver(t *testing.T) {
 	if len(tvCalls) != 1 {
 		t.Fatalf("expected 1 TV call, got %d", len(tvCalls))
 	}
-	if tvCalls[0] != `{"command": "PowerOff"}` {
+	if tvCalls[0] != `{"command":"PowerOff"}` {
 		t.Errorf("unexpected TV call: %s", tvCalls[0])
 	}
 	if len(receiverCalls) != 1 {
 		t.Fatalf("expected 1 receiver call, got %d", len(receiverCalls))
 	}
-	if receiverCalls[0] != `{"on": false}` {
+	if receiverCalls[0] != `{"on":false}` {
 		t.Errorf("unexpected receiver call: %s", receiverCalls[0])
 	}
 }
@@ -100,10 +125,10 @@ func TestHandleIntent_OFF_NoReceiver(t *testing.T) {
 	handler := handleIntent(room)
 
 	req := newEchoRequest("OFF", nil)
-	resp := alexa.NewEchoResponse()
+	resp := alexa.NewResponse()
 	handler(req, resp)
 
-	time.Sleep(100 * time.Millisecond)
+	pending.Wait()
 
 	mu.Lock()
 	defer mu.Unlock()
@@ -114,11 +139,8 @@ func TestHandleIntent_OFF_NoReceiver(t *testing.T) {
 }
 
 func TestHandleIntent_MUTE_WithReceiver(t *testing.T) {
-	var receiverBody string
-	receiverServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		body, _ := io.ReadAll(r.Body)
-		receiverBody = string(body)
-	}))
+	receiver := &deviceRecorder{}
+	receiverServer := httptest.NewServer(receiver)
 	defer receiverServer.Close()
 
 	tvServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
@@ -128,66 +150,57 @@ func TestHandleIntent_MUTE_WithReceiver(t *testing.T) {
 	handler := handleIntent(room)
 
 	req := newEchoRequest("MUTE", nil)
-	resp := alexa.NewEchoResponse()
+	resp := alexa.NewResponse()
 	handler(req, resp)
 
-	time.Sleep(100 * time.Millisecond)
+	pending.Wait()
 
-	if receiverBody != `{"mute": true}` {
-		t.Errorf("expected mute payload, got %q", receiverBody)
+	if got := strings.Join(receiver.Calls(), "\n"); got != `{"mute":true}` {
+		t.Errorf("expected mute payload, got %q", got)
 	}
 }
 
 func TestHandleIntent_MUTE_NoReceiver(t *testing.T) {
-	var tvBody string
-	tvServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		body, _ := io.ReadAll(r.Body)
-		tvBody = string(body)
-	}))
+	tv := &deviceRecorder{}
+	tvServer := httptest.NewServer(tv)
 	defer tvServer.Close()
 
 	room := testRoom(tvServer.URL, "", "")
 	handler := handleIntent(room)
 
 	req := newEchoRequest("MUTE", nil)
-	resp := alexa.NewEchoResponse()
+	resp := alexa.NewResponse()
 	handler(req, resp)
 
-	time.Sleep(100 * time.Millisecond)
+	pending.Wait()
 
-	if tvBody != `{"command": "Mute"}` {
-		t.Errorf("expected Mute command, got %q", tvBody)
+	if got := strings.Join(tv.Calls(), "\n"); got != `{"command":"Mute"}` {
+		t.Errorf("expected Mute command, got %q", got)
 	}
 }
 
 func TestHandleIntent_CHANNEL(t *testing.T) {
-	var tvBody string
-	tvServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		body, _ := io.ReadAll(r.Body)
-		tvBody = string(body)
-	}))
+	tv := &deviceRecorder{}
+	tvServer := httptest.NewServer(tv)
 	defer tvServer.Close()
 
 	room := testRoom(tvServer.URL, "", "")
 	handler := handleIntent(room)
 
 	req := newEchoRequest("Channel", map[string]string{"Number": "42"})
-	resp := alexa.NewEchoResponse()
+	resp := alexa.NewResponse()
 	handler(req, resp)
 
-	time.Sleep(100 * time.Millisecond)
+	pending.Wait()
 
-	if tvBody != `{"command": "Channel", "value": "42"}` {
-		t.Errorf("unexpected TV body: %s", tvBody)
+	if got := strings.Join(tv.Calls(), "\n"); got != `{"command":"Channel","value":"42"}` {
+		t.Errorf("unexpected TV body: %s", got)
 	}
 }
 
 func TestHandleIntent_HOME(t *testing.T) {
-	var rokuBody string
-	rokuServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		body, _ := io.ReadAll(r.Body)
-		rokuBody = string(body)
-	}))
+	roku := &deviceRecorder{}
+	rokuServer := httptest.NewServer(roku)
 	defer rokuServer.Close()
 
 	tvServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
@@ -197,22 +210,19 @@ func TestHandleIntent_HOME(t *testing.T) {
 	handler := handleIntent(room)
 
 	req := newEchoRequest("HOME", nil)
-	resp := alexa.NewEchoResponse()
+	resp := alexa.NewResponse()
 	handler(req, resp)
 
-	time.Sleep(100 * time.Millisecond)
+	pending.Wait()
 
-	if rokuBody != `{"command": "home"}` {
-		t.Errorf("unexpected Roku body: %s", rokuBody)
+	if got := strings.Join(roku.Calls(), "\n"); got != `{"command":"home"}` {
+		t.Errorf("unexpected Roku body: %s", got)
 	}
 }
 
 func TestHandleIntent_Direction_WithSpaces(t *testing.T) {
-	var rokuBody string
-	rokuServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		body, _ := io.ReadAll(r.Body)
-		rokuBody = string(body)
-	}))
+	roku := &deviceRecorder{}
+	rokuServer := httptest.NewServer(roku)
 	defer rokuServer.Close()
 
 	tvServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
@@ -222,13 +232,13 @@ func TestHandleIntent_Direction_WithSpaces(t *testing.T) {
 	handler := handleIntent(room)
 
 	req := newEchoRequest("UP", map[string]string{"Spaces": "3"})
-	resp := alexa.NewEchoResponse()
+	resp := alexa.NewResponse()
 	handler(req, resp)
 
-	time.Sleep(100 * time.Millisecond)
+	pending.Wait()
 
-	if rokuBody != `{"command": "up", "value": "3"}` {
-		t.Errorf("unexpected Roku body: %s", rokuBody)
+	if got := strings.Join(roku.Calls(), "\n"); got != `{"command":"up","value":"3"}` {
+		t.Errorf("unexpected Roku body: %s", got)
 	}
 }
 
@@ -240,14 +250,14 @@ func TestHandleIntent_Default(t *testing.T) {
 	handler := handleIntent(room)
 
 	req := newEchoRequest("UNKNOWNINTENT", nil)
-	resp := alexa.NewEchoResponse()
+	resp := alexa.NewResponse()
 	handler(req, resp)
 
 	if resp.Response.OutputSpeech == nil {
 		t.Fatal("expected output speech")
 	}
-	if resp.Response.OutputSpeech.Text != "I'm sorry I could not process your request UNKNOWNINTENT." {
-		t.Errorf("unexpected output: %s", resp.Response.OutputSpeech.Text)
+	if speechText(resp) != "I'm sorry, I couldn't do that." {
+		t.Errorf("unexpected output: %s", speechText(resp))
 	}
 }
 
@@ -260,13 +270,227 @@ func TestHandleIntent_SlotError(t *testing.T) {
 
 	// CHANNEL without Number slot
 	req := newEchoRequest("Channel", nil)
-	resp := alexa.NewEchoResponse()
+	resp := alexa.NewResponse()
 	handler(req, resp)
 
 	if resp.Response.OutputSpeech == nil {
 		t.Fatal("expected output speech")
 	}
-	if resp.Response.OutputSpeech.Text != "I'm sorry I could not process your request CHANNEL." {
-		t.Errorf("unexpected output: %s", resp.Response.OutputSpeech.Text)
+	if speechText(resp) != "I'm sorry, I couldn't change the channel. Say a channel number, like 5 or 5.1." {
+		t.Errorf("unexpected output: %s", speechText(resp))
+	}
+	if resp.Response.Reprompt == nil || resp.Response.Reprompt.OutputSpeech.Text != "Say a channel number, like 5 or 5.1." {
+		t.Errorf("unexpected reprompt: %+v", resp.Response.Reprompt)
+	}
+	if end := resp.Response.ShouldEndSession; end == nil || *end {
+		t.Error("expected the session to stay open for an answer")
+	}
+}
+
+func TestHandleIntent_SLEEPTIMER(t *testing.T) {
+	scheduler = NewScheduler(filepath.Join(t.TempDir(), "schedules.json"), func(string) {})
+	defer func() { scheduler = nil }()
+
+	room := testRoom("", "", "")
+	handler := handleIntent(room)
+
+	resp := alexa.NewResponse()
+	handler(newEchoRequest("SleepTimer", map[string]string{"Duration": "PT30M"}), resp)
+	if speechText(resp) != "The Test Room will turn off in 30 minutes." {
+		t.Errorf("unexpected output: %s", speechText(resp))
+	}
+	if _, ok := scheduler.SleepTimer(room.ID); !ok {
+		t.Fatal("expected sleep timer to be set")
+	}
+
+	resp = alexa.NewResponse()
+	handler(newEchoRequest("TimeLeft", nil), resp)
+	if !strings.HasPrefix(speechText(resp), "The Test Room will turn off in ") {
+		t.Errorf("unexpected output: %s", speechText(resp))
+	}
+
+	resp = alexa.NewResponse()
+	handler(newEchoRequest("CancelTimer", nil), resp)
+	if speechText(resp) != "Cancelled the Test Room sleep timer." {
+		t.Errorf("unexpected output: %s", speechText(resp))
+	}
+
+	resp = alexa.NewResponse()
+	handler(newEchoRequest("TimeLeft", nil), resp)
+	if speechText(resp) != "There is no sleep timer set for the Test Room." {
+		t.Errorf("unexpected output: %s", speechText(resp))
+	}
+}
+
+func TestHandleIntent_SCHEDULE(t *testing.T) {
+	scheduler = NewScheduler(filepath.Join(t.TempDir(), "schedules.json"), func(string) {})
+	defer func() { scheduler = nil }()
+
+	room := testRoom("", "", "")
+	handler := handleIntent(room)
+
+	resp := alexa.NewResponse()
+	handler(newEchoRequest("Schedule", map[string]string{"Time": "23:00", "Days": "weeknights"}), resp)
+	if speechText(resp) != "The Test Room will turn off on weeknights at 11:00 PM." {
+		t.Errorf("unexpected output: %s", speechText(resp))
+	}
+	if len(scheduler.List()) != 1 {
+		t.Fatalf("expected 1 schedule, got %d", len(scheduler.List()))
+	}
+
+	resp = alexa.NewResponse()
+	handler(newEchoRequest("CancelSchedule", nil), resp)
+	if speechText(resp) != "Cancelled the Test Room schedules." {
+		t.Errorf("unexpected output: %s", speechText(resp))
+	}
+}
+
+func TestHandleIntent_MUTE_NoReceiver_Idempotent(t *testing.T) {
+	var mu sync.Mutex
+	var tvCalls []string
+	tvServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		tvCalls = append(tvCalls, string(body))
+		mu.Unlock()
+	}))
+	defer tvServer.Close()
+
+	room := testRoom(tvServer.URL, "", "")
+	states.Update(room.ID, func(s *RoomState) { s.Power = true })
+	handler := handleIntent(room)
+
+	for _, intent := range []string{"MUTE", "MUTE", "UNMUTE", "UNMUTE"} {
+		handler(newEchoRequest(intent, nil), alexa.NewResponse())
+		pending.Wait()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(tvCalls) != 2 {
+		t.Fatalf("expected 2 Mute toggles, got %d: %v", len(tvCalls), tvCalls)
+	}
+	if states.Get(room.ID).Muted {
+		t.Error("expected room to end unmuted")
+	}
+}
+
+func TestHandleIntent_VOLUMEUP_WithReceiver(t *testing.T) {
+	receiver := &deviceRecorder{}
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+
+	room := testRoom("", "", receiverServer.URL)
+	states.Update(room.ID, func(s *RoomState) { s.Power = true; s.Volume = 30; s.VolumeKnown = true })
+	handler := handleIntent(room)
+
+	handler(newEchoRequest("VolumeUp", map[string]string{"Amount": "10"}), alexa.NewResponse())
+	pending.Wait()
+
+	if got := strings.Join(receiver.Calls(), "\n"); got != `{"volume":-20}` {
+		t.Errorf("unexpected receiver body: %s", got)
+	}
+	if states.Get(room.ID).Volume != 20 {
+		t.Errorf("expected tracked volume 20, got %d", states.Get(room.ID).Volume)
+	}
+}
+
+func TestHandleIntent_VOLUMEUP_FromZero(t *testing.T) {
+	tv := &deviceRecorder{}
+	tvServer := httptest.NewServer(tv)
+	defer tvServer.Close()
+
+	room := testRoom(tvServer.URL, "", "")
+	states.Update(room.ID, func(s *RoomState) { s.Power = true; s.Volume = 0; s.VolumeKnown = true })
+	handler := handleIntent(room)
+
+	handler(newEchoRequest("VolumeUp", nil), alexa.NewResponse())
+	pending.Wait()
+
+	if got := strings.Join(tv.Calls(), "\n"); got != `{"command":"Volume","value":"5"}` {
+		t.Errorf("unexpected TV body: %s", got)
+	}
+	if states.Get(room.ID).Volume != 5 {
+		t.Errorf("expected tracked volume 5, got %d", states.Get(room.ID).Volume)
+	}
+}
+
+func TestHandleIntent_VOLUMEUP_Unknown(t *testing.T) {
+	room := testRoom("http://tv.invalid", "", "")
+	handler := handleIntent(room)
+
+	resp := alexa.NewResponse()
+	handler(newEchoRequest("VolumeUp", nil), resp)
+
+	if speechText(resp) != "I don't know the current volume in the Test Room." {
+		t.Errorf("unexpected output: %s", speechText(resp))
+	}
+}
+
+func TestHandleIntent_STATUS_AfterInput(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+
+	room := testRoom(ok.URL, ok.URL, ok.URL)
+	handler := handleIntent(room)
+
+	handler(newEchoRequest("Input", map[string]string{"InputType": "netflix"}), alexa.NewResponse())
+	pending.Wait()
+
+	resp := alexa.NewResponse()
+	handler(newEchoRequest("Status", nil), resp)
+	if speechText(resp) != "The Test Room is on Netflix, volume 30." {
+		t.Errorf("unexpected output: %s", speechText(resp))
+	}
+}
+
+func TestHandleIntent_CHANNEL_Named(t *testing.T) {
+	var mu sync.Mutex
+	var tvCalls []string
+	tvServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		tvCalls = append(tvCalls, string(body))
+		mu.Unlock()
+	}))
+	defer tvServer.Close()
+
+	room := testRoom(tvServer.URL, "", "")
+	room.Channels = map[string]ChannelConfig{
+		"ESPN":            {Number: "32", Input: "TV"},
+		"CHANNELFOURNEWS": {Number: "4.1", Input: "TV"},
+	}
+	states.Update(room.ID, func(s *RoomState) { s.Power = true; s.Input = "NETFLIX" })
+	handler := handleIntent(room)
+
+	// Off the antenna: switch input, then tune.
+	handler(newEchoRequest("Channel", map[string]string{"Number": "espn"}), alexa.NewResponse())
+	pending.Wait()
+	if st := states.Get(room.ID); st.Input != "TV" {
+		t.Errorf("expected input TV, got %q", st.Input)
+	}
+	// Already on the antenna: just tune.
+	handler(newEchoRequest("Channel", map[string]string{"Number": "channel four news"}), alexa.NewResponse())
+	pending.Wait()
+	handler(newEchoRequest("Channel", map[string]string{"Number": "7"}), alexa.NewResponse())
+	pending.Wait()
+
+	resp := alexa.NewResponse()
+	handler(newEchoRequest("Channel", map[string]string{"Number": "HBO"}), resp)
+	if speechText(resp) != "I'm sorry, HBO isn't a channel I can use. Say a channel number, like 5 or 5.1, or a channel name." {
+		t.Errorf("unexpected output: %s", speechText(resp))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		`{"command":"PowerOn"}`,
+		`{"command":"InputTV"}`,
+		`{"command":"Channel","value":"32"}`,
+		`{"command":"Channel","value":"4.1"}`,
+		`{"command":"Channel","value":"7"}`,
+	}
+	if strings.Join(tvCalls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("TV calls:\n%s\nwant:\n%s", strings.Join(tvCalls, "\n"), strings.Join(want, "\n"))
 	}
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// probeTTL is how long a device probe result is reused.
+const probeTTL = 30 * time.Second
+
+// deviceProbe is the reachability of one device as reported by /readyz.
+type deviceProbe struct {
+	Device   string    `json:"device"`
+	Host     string    `json:"host"`
+	Critical bool      `json:"critical"`
+	Up       bool      `json:"up"`
+	Error    string    `json:"error,omitempty"`
+	Checked  time.Time `json:"checked"`
+}
+
+// readiness is the /readyz response body.
+type readiness struct {
+	Ready bool                     `json:"ready"`
+	Rooms map[string][]deviceProbe `json:"rooms"`
+}
+
+// Prober checks device reachability with a TCP connect, which has no side
+// effects on the device bridges, and caches the results.
+type Prober struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	timeout time.Duration
+	now     func() time.Time
+	cache   map[string]deviceProbe
+}
+
+// prober is the process-wide device prober.
+var prober = NewProber(probeTTL)
+
+// NewProber returns a prober that reuses results for ttl.
+func NewProber(ttl time.Duration) *Prober {
+	return &Prober{ttl: ttl, timeout: 2 * time.Second, now: time.Now, cache: make(map[string]deviceProbe)}
+}
+
+// Probe reports whether host accepts connections, using a cached result
+// when it is fresh enough.
+func (p *Prober) Probe(host string) deviceProbe {
+	p.mu.Lock()
+	cached, ok := p.cache[host]
+	p.mu.Unlock()
+	if ok && p.now().Sub(cached.Checked) < p.ttl {
+		return cached
+	}
+
+	result := deviceProbe{Host: host, Up: true, Checked: p.now()}
+	if err := p.dial(host); err != nil {
+		result.Up = false
+		result.Error = err.Error()
+	}
+
+	p.mu.Lock()
+	p.cache[host] = result
+	p.mu.Unlock()
+	return result
+}
+
+func (p *Prober) dial(host string) error {
+	u, err := url.Parse(host)
+	if err != nil {
+		return err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", addr, p.timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// roomDevices lists a room's configured devices. The TV and receiver are
+// critical; without the Roku only streaming inputs are lost.
+func roomDevices(room Room) []deviceProbe {
+	devices := []deviceProbe{{Device: "tv", Host: room.TVActionHost, Critical: true}}
+	if room.RokuActionHost != "" {
+		devices = append(devices, deviceProbe{Device: "roku", Host: room.RokuActionHost})
+	}
+	if room.ReceiverHost != "" {
+		devices = append(devices, deviceProbe{Device: "receiver", Host: room.ReceiverHost, Critical: true})
+	}
+	return devices
+}
+
+// checkReadiness probes every device in every room concurrently.
+func checkReadiness(p *Prober) readiness {
+	result := readiness{Ready: true, Rooms: make(map[string][]deviceProbe)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, room := range Rooms {
+		probes := roomDevices(room)
+		result.Rooms[room.ID] = probes
+		for i := range probes {
+			wg.Add(1)
+			go func(d *deviceProbe) {
+				defer wg.Done()
+				r := p.Probe(d.Host)
+				mu.Lock()
+				defer mu.Unlock()
+				d.Up, d.Error, d.Checked = r.Up, r.Error, r.Checked
+				if d.Critical && !d.Up {
+					result.Ready = false
+				}
+			}(&probes[i])
+		}
+	}
+	wg.Wait()
+	for _, probes := range result.Rooms {
+		sort.SliceStable(probes, func(i, j int) bool { return probes[i].Device < probes[j].Device })
+	}
+	return result
+}
+
+// healthzHandler reports that the process is alive.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyzHandler reports per-room device reachability, failing with 503 when
+// any critical device is down. Devices are not probed in dry-run mode.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if dryRun.Load() {
+		writeJSON(w, http.StatusOK, readiness{Ready: true})
+		return
+	}
+	result := checkReadiness(prober)
+	status := http.StatusOK
+	if !result.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, result)
+}
+
+// healthcheck probes the local /healthz endpoint for Docker's HEALTHCHECK,
+// since the distroless image has no curl. It returns the process exit code.
+// The server's own certificate is not verified, as it may be self-signed.
+func healthcheck(target string) int {
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	resp, err := client.Get(target)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 1
+	}
+	return 0
+}
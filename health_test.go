@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// closedURL returns the URL of a server that is no longer listening.
+func closedURL() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL
+}
+
+func TestProber_CachesResults(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	now := time.Now()
+	p := NewProber(time.Minute)
+	p.now = func() time.Time { return now }
+
+	if r := p.Probe(server.URL); !r.Up {
+		t.Fatalf("expected up, got %+v", r)
+	}
+	server.Close()
+	if r := p.Probe(server.URL); !r.Up {
+		t.Error("expected cached up result within TTL")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if r := p.Probe(server.URL); r.Up || r.Error == "" {
+		t.Errorf("expected down after TTL, got %+v", r)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	up := httptest.NewServer(http.NotFoundHandler())
+	defer up.Close()
+
+	saved, savedProber := Rooms, prober
+	defer func() { Rooms, prober = saved, savedProber }()
+
+	tests := []struct {
+		name       string
+		room       Room
+		wantStatus int
+	}{
+		{"all up", testRoom(up.URL, up.URL, up.URL), http.StatusOK},
+		{"roku down", testRoom(up.URL, closedURL(), up.URL), http.StatusOK},
+		{"tv down", testRoom(closedURL(), up.URL, ""), http.StatusServiceUnavailable},
+		{"receiver down", testRoom(up.URL, up.URL, closedURL()), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Rooms = map[string]Room{tt.room.ID: tt.room}
+			prober = NewProber(time.Minute)
+
+			rec := httptest.NewRecorder()
+			readyzHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			var got readiness
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Ready != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("ready = %v", got.Ready)
+			}
+			for _, d := range got.Rooms["test"] {
+				if d.Up == (d.Error != "") {
+					t.Errorf("%s: up = %v with error %q", d.Device, d.Up, d.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthcheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(healthzHandler))
+	defer server.Close()
+
+	if code := healthcheck(server.URL); code != 0 {
+		t.Errorf("healthcheck = %d, want 0", code)
+	}
+	if code := healthcheck(closedURL()); code != 1 {
+		t.Errorf("healthcheck on closed server = %d, want 1", code)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// historyLimit is how many previous states are kept per room for UNDO.
+const historyLimit = 10
+
+// History keeps a bounded stack of previous room states for UNDO.
+type History struct {
+	mu    sync.Mutex
+	limit int
+	rooms map[string][]RoomState
+}
+
+// history is the process-wide undo history.
+var history = NewHistory(historyLimit)
+
+// NewHistory returns a history keeping at most limit states per room.
+func NewHistory(limit int) *History {
+	return &History{limit: limit, rooms: make(map[string][]RoomState)}
+}
+
+// Push records a room state, dropping the oldest once the limit is reached.
+func (h *History) Push(roomID string, st RoomState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := append(h.rooms[roomID], st)
+	if len(list) > h.limit {
+		list = list[len(list)-h.limit:]
+	}
+	h.rooms[roomID] = list
+}
+
+// Pop removes and returns the most recent state recorded for a room.
+func (h *History) Pop(roomID string) (RoomState, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := h.rooms[roomID]
+	if len(list) == 0 {
+		return RoomState{}, false
+	}
+	st := list[len(list)-1]
+	h.rooms[roomID] = list[:len(list)-1]
+	return st, true
+}
+
+// undoPoint is the state an undoable intent started from. It goes onto the
+// room's history once the intent's device calls change the room, so an
+// intent that changes nothing leaves nothing to undo.
+type undoPoint struct {
+	once sync.Once
+	st   RoomState
+}
+
+type undoPointKey struct{}
+
+// withUndoPoint returns a context whose state updates make st undoable.
+func withUndoPoint(ctx context.Context, st RoomState) context.Context {
+	return context.WithValue(ctx, undoPointKey{}, &undoPoint{st: st})
+}
+
+// undo restores the room to the state recorded before its last change.
+func undo(ctx context.Context, room Room) reply {
+	prev, ok := history.Pop(room.ID)
+	if !ok {
+		return refused("There's nothing to undo in the " + room.Name + ".")
+	}
+	cur := states.Get(room.ID)
+
+	if !prev.Power {
+		setPower(ctx, room, false)
+		return acknowledged
+	}
+
+	if prev.Input != "" && (prev.Input != cur.Input || !cur.Power) {
+		if room.ReceiverHost == "" {
+			setInput(ctx, room, prev.Input, "")
+		} else {
+			// Switching input sets the receiver's volume, so the previous
+			// volume and mute go in that same update rather than after it.
+			volume := -room.DefaultVolume
+			if prev.VolumeKnown {
+				volume = prev.Volume
+			}
+			muted := prev.MuteKnown && prev.Muted
+			setInputAt(ctx, room, prev.Input, "", volume, muted)
+			cur.Volume, cur.VolumeKnown = volume, true
+			cur.Muted, cur.MuteKnown = muted, true
+		}
+	} else if !cur.Power {
+		setPower(ctx, room, true)
+	}
+
+	if prev.VolumeKnown && prev.Volume != cur.Volume {
+		setVolume(ctx, room, strconv.Itoa(prev.Volume))
+	}
+	if prev.MuteKnown && prev.Muted != cur.Muted {
+		setMute(ctx, room, prev.Muted)
+	}
+	return acknowledged
+}
+
+// commandLogLimit is how many handled intents are kept per room.
+const commandLogLimit = 50
+
+// Command is one handled intent, kept for the admin API.
+type Command struct {
+	Time   time.Time         `json:"time"`
+	Intent string            `json:"intent"`
+	Slots  map[string]string `json:"slots,omitempty"`
+	Speech string            `json:"speech"`
+}
+
+// CommandLog keeps the most recent intents handled for each room.
+type CommandLog struct {
+	mu    sync.Mutex
+	limit int
+	rooms map[string][]Command
+}
+
+// commands is the process-wide command log.
+var commands = NewCommandLog(commandLogLimit)
+
+// NewCommandLog returns a log keeping at most limit commands per room.
+func NewCommandLog(limit int) *CommandLog {
+	return &CommandLog{limit: limit, rooms: make(map[string][]Command)}
+}
+
+// Record appends a command, dropping the oldest once the limit is reached.
+func (l *CommandLog) Record(roomID string, cmd Command) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := append(l.rooms[roomID], cmd)
+	if len(list) > l.limit {
+		list = list[len(list)-l.limit:]
+	}
+	l.rooms[roomID] = list
+}
+
+// Recent returns a room's commands, newest first.
+func (l *CommandLog) Recent(roomID string) []Command {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := l.rooms[roomID]
+	out := make([]Command, len(list))
+	for i, cmd := range list {
+		out[len(list)-1-i] = cmd
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+func TestHistory_Bounded(t *testing.T) {
+	h := NewHistory(3)
+	for i := 1; i <= 5; i++ {
+		h.Push("fr", RoomState{Volume: i})
+	}
+
+	for _, want := range []int{5, 4, 3} {
+		st, ok := h.Pop("fr")
+		if !ok || st.Volume != want {
+			t.Fatalf("Pop = %+v, %v; want volume %d", st, ok, want)
+		}
+	}
+	if _, ok := h.Pop("fr"); ok {
+		t.Error("expected history to be exhausted")
+	}
+	if _, ok := h.Pop("mbr"); ok {
+		t.Error("expected empty history for other room")
+	}
+}
+
+func TestHandleIntent_UNDO_Input(t *testing.T) {
+	tv := &deviceRecorder{}
+	tvServer := httptest.NewServer(tv)
+	defer tvServer.Close()
+	roku := &deviceRecorder{}
+	rokuServer := httptest.NewServer(roku)
+	defer rokuServer.Close()
+
+	history = NewHistory(historyLimit)
+	room := testRoom(tvServer.URL, rokuServer.URL, "")
+	handler := handleIntent(room)
+
+	handler(newEchoRequest("Input", map[string]string{"InputType": "tv"}), alexa.NewResponse())
+	pending.Wait()
+	handler(newEchoRequest("Input", map[string]string{"InputType": "netflix"}), alexa.NewResponse())
+	pending.Wait()
+
+	if got := states.Get(room.ID).Input; got != "NETFLIX" {
+		t.Fatalf("expected NETFLIX before undo, got %q", got)
+	}
+
+	handler(newEchoRequest("Undo", nil), alexa.NewResponse())
+	pending.Wait()
+
+	if got := states.Get(room.ID).Input; got != "TV" {
+		t.Errorf("expected TV after undo, got %q", got)
+	}
+	calls := tv.Calls()
+	if last := calls[len(calls)-1]; last != `{"command":"InputTV"}` {
+		t.Errorf("expected last TV call to switch to InputTV, got %s", last)
+	}
+}
+
+func TestHandleIntent_UNDO_Off(t *testing.T) {
+	tv := &deviceRecorder{}
+	tvServer := httptest.NewServer(tv)
+	defer tvServer.Close()
+
+	history = NewHistory(historyLimit)
+	room := testRoom(tvServer.URL, "", "")
+	states.Update(room.ID, func(s *RoomState) { s.Power = true; s.Input = "TV" })
+	handler := handleIntent(room)
+
+	handler(newEchoRequest("Off", nil), alexa.NewResponse())
+	pending.Wait()
+	handler(newEchoRequest("Undo", nil), alexa.NewResponse())
+	pending.Wait()
+
+	st := states.Get(room.ID)
+	if !st.Power || st.Input != "TV" {
+		t.Errorf("expected room back on TV, got %+v", st)
+	}
+}
+
+func TestHandleIntent_UNDO_Empty(t *testing.T) {
+	history = NewHistory(historyLimit)
+	room := testRoom("", "", "")
+	handler := handleIntent(room)
+
+	resp := alexa.NewResponse()
+	handler(newEchoRequest("Undo", nil), resp)
+
+	if speechText(resp) != "There's nothing to undo in the Test Room." {
+		t.Errorf("unexpected output: %s", speechText(resp))
+	}
+}
+
+func TestHandleIntent_UNDO_ReceiverVolume(t *testing.T) {
+	tv := &deviceRecorder{}
+	tvServer := httptest.NewServer(tv)
+	defer tvServer.Close()
+	receiver := &deviceRecorder{}
+	receiverServer := httptest.NewServer(receiver)
+	defer receiverServer.Close()
+
+	history = NewHistory(historyLimit)
+	room := testRoom(tvServer.URL, "", receiverServer.URL)
+	states.Update(room.ID, func(s *RoomState) {
+		s.Power, s.Input = true, "TV"
+		s.Volume, s.VolumeKnown = 45, true
+		s.Muted, s.MuteKnown = true, true
+	})
+	handler := handleIntent(room)
+
+	handler(newEchoRequest("Input", map[string]string{"InputType": "netflix"}), alexa.NewResponse())
+	pending.Wait()
+	before := len(receiver.Calls())
+	handler(newEchoRequest("Undo", nil), alexa.NewResponse())
+	pending.Wait()
+
+	// The previous volume and mute ride on the input switch, so there is
+	// no later volume call for the switch's default volume to race.
+	want := `{"input":"AV1","mute":true,"on":true,"volume":-45}`
+	if got := strings.Join(receiver.Calls()[before:], "\n"); got != want {
+		t.Errorf("receiver calls after undo:\n%s\nwant %s", got, want)
+	}
+	st := states.Get(room.ID)
+	if st.Input != "TV" || st.Volume != 45 || !st.Muted {
+		t.Errorf("expected TV at 45 muted, got %+v", st)
+	}
+}
+
+func TestHandleIntent_UNDO_SkipsNoOps(t *testing.T) {
+	tv := &deviceRecorder{}
+	tvServer := httptest.NewServer(tv)
+	defer tvServer.Close()
+
+	history = NewHistory(historyLimit)
+	room := testRoom(tvServer.URL, "", "")
+	states.Update(room.ID, func(s *RoomState) {
+		s.Power = true
+		s.Volume, s.VolumeKnown = 30, true
+		s.MuteKnown = true
+	})
+	handler := handleIntent(room)
+
+	handler(newEchoRequest("Volume", map[string]string{"Level": "30"}), alexa.NewResponse())
+	pending.Wait()
+
+	resp := alexa.NewResponse()
+	handler(newEchoRequest("Undo", nil), resp)
+	if speechText(resp) != "There's nothing to undo in the Test Room." {
+		t.Errorf("a volume change to the same level should leave nothing to undo, got %s", speechText(resp))
+	}
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"strings"
 	"time"
 )
 
@@ -13,19 +13,40 @@ type InputConfig struct {
 	RokuApp       string // if non-empty, launch this Roku app
 }
 
-// addAliases maps multiple aliases to the same InputConfig.
-func addAliases(m map[string]InputConfig, cfg InputConfig, aliases ...string) {
+// ChannelConfig is a named channel in a room's lineup.
+type ChannelConfig struct {
+	Number string // channel to tune, e.g. "32" or "4.1"
+	Input  string // InputMap key to switch to first (e.g., "TV" for the antenna); empty to stay on the current input
+}
+
+// addAliases maps multiple aliases to the same InputConfig or ChannelConfig.
+func addAliases[T any](m map[string]T, cfg T, aliases ...string) {
 	for _, alias := range aliases {
 		m[alias] = cfg
 	}
 }
 
-// setInput switches the input for a room based on the input type.
-func setInput(room Room, inputType string) {
-	log.Println("Input passed: ", inputType)
+// aliasKey is how an input or channel name as said is looked up: upper
+// case, without spaces.
+func aliasKey(said string) string {
+	return strings.ReplaceAll(strings.ToUpper(said), " ", "")
+}
+
+// setInput switches the input for a room based on the input type. If
+// channel is set, the TV is tuned to it once it is on the new input. A
+// receiver is set to the room's default volume.
+func setInput(ctx context.Context, room Room, inputType string, channel string) {
+	setInputAt(ctx, room, inputType, channel, -room.DefaultVolume, false)
+}
 
+// setInputAt is setInput with the volume level and mute the receiver is set
+// to, so UNDO can restore them in the same receiver update that switches
+// input instead of racing it.
+func setInputAt(ctx context.Context, room Room, inputType string, channel string, volume int, muted bool) {
 	cfg, ok := room.InputMap[inputType]
 	if !ok {
+		logger(ctx).Info("unknown input, launching as Roku app", "input", inputType)
+		unresolvedInputsTotal.Add(1, room.ID)
 		cfg = InputConfig{
 			ReceiverInput: "HDMI1",
 			TVInput:       "HDMI1",
@@ -38,15 +59,41 @@ func setInput(room Room, inputType string) {
 		if receiverInput == "" {
 			receiverInput = "HDMI1"
 		}
-		payload := fmt.Sprintf(`{"on":true, "volume": %d, "input": "%s"}`, room.DefaultVolume, receiverInput)
-		go updateReceiver(room.ReceiverHost, payload)
+		payload := map[string]any{"on": true, "volume": -volume, "input": receiverInput}
+		if muted {
+			payload["mute"] = true
+		}
+		track(ctx, room, func() error { return updateReceiver(ctx, room.ReceiverHost, payload) }, func(s *RoomState) {
+			s.Volume = volume
+			s.VolumeKnown = true
+			s.Muted = muted
+			s.MuteKnown = true
+		})
 	}
 
-	if cfg.RokuApp != "" {
-		go executeAction(room.RokuActionHost, "input", cfg.RokuApp)
+	if cfg.RokuApp != "" && room.has(deviceRoku) {
+		goAction(ctx, room.RokuActionHost, "input", cfg.RokuApp)
 	}
 
-	go executeAction(room.TVActionHost, "PowerOn", "")
+	powerOnTV(ctx, room)
+	_, wait := startSpan(ctx, "wait for TV", spanInternal, "room", room.ID)
 	time.Sleep(500 * time.Millisecond)
-	go executeAction(room.TVActionHost, cfg.TVInput, "")
+	wait.End()
+	update := func(s *RoomState) {
+		s.Power = true
+		s.Input = inputType
+		s.RokuApp = cfg.RokuApp
+	}
+	if channel == "" {
+		track(ctx, room, func() error { return executeAction(ctx, room.TVActionHost, cfg.TVInput, "") }, update)
+		return
+	}
+	expect(ctx, update)
+	background(ctx, func() {
+		if executeAction(ctx, room.TVActionHost, cfg.TVInput, "") != nil {
+			return
+		}
+		applyUpdate(ctx, room, update)
+		executeAction(ctx, room.TVActionHost, "Channel", channel)
+	})
 }
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// device is a piece of equipment an intent drives.
+type device string
+
+const (
+	deviceTV       device = "TV"
+	deviceTVRemote device = "TV remote" // the TV's navigation and playback keys
+	deviceRoku     device = "Roku"
+	deviceReceiver device = "receiver"
+)
+
+// intentHandler carries out an intent and returns the reply as for
+// Responses.Render.
+type intentHandler func(ctx context.Context, room Room, req *IntentRequest) reply
+
+// intentRoute is one way of carrying out an intent, on a device the room
+// may or may not have.
+type intentRoute struct {
+	Device device
+	Handle intentHandler
+}
+
+// intentSpec declares an intent: what it's called, the slots it takes, and
+// how it is carried out. An intent that drives a device has Routes, tried
+// in order of preference; the first whose device the room has is used. One
+// that doesn't has only Handle. Handlers run once every slot is valid.
+type intentSpec struct {
+	Name     string
+	Aliases  []string
+	Slots    []slotSpec
+	Routes   []intentRoute
+	Handle   intentHandler
+	Undoable bool // the intent changes room state, so UNDO can revert it
+}
+
+// handler returns how the room carries out the intent, or nil if it has
+// none of the devices the intent needs.
+func (s *intentSpec) handler(room Room) intentHandler {
+	if len(s.Routes) == 0 {
+		return s.Handle
+	}
+	for _, r := range s.Routes {
+		if room.has(r.Device) {
+			return r.Handle
+		}
+	}
+	return nil
+}
+
+// run checks the request against the spec and calls its handler. Slot
+// values are replaced with their parsed forms first. A missing or invalid
+// slot gets an apology and a reprompt saying what the slot takes.
+func (s *intentSpec) run(ctx context.Context, room Room, req *IntentRequest) (out reply, reprompt string) {
+	handle := s.handler(room)
+	if handle == nil {
+		logger(ctx).Warn("unsupported intent", "devices", room.devices())
+		return failed("I'm sorry, the " + room.Name + " doesn't have that."), ""
+	}
+	parsed := make(map[string]string, len(req.Slots))
+	for name, value := range req.Slots {
+		parsed[name] = value
+	}
+	for _, slot := range s.Slots {
+		value, err := req.Slot(slot.Name)
+		if err != nil {
+			if slot.Required {
+				logger(ctx).Warn("missing slot", "slot", slot.Name, "err", err)
+				return withHint(sorry(s.Name), slot.hint(room)), slot.hint(room)
+			}
+			continue
+		}
+		v, ok := slot.parse(room, value)
+		if !ok {
+			logger(ctx).Warn("invalid slot", "slot", slot.Name, "value", value)
+			return withHint(failed("I'm sorry, "+value+" isn't a "+slot.Noun+" I can use."), slot.hint(room)), slot.hint(room)
+		}
+		parsed[slot.Name] = v
+	}
+	req.Slots = parsed
+	if s.Undoable {
+		if st := states.Get(room.ID); st.Known() {
+			ctx = withUndoPoint(ctx, st)
+		}
+	}
+	return handle(ctx, room, req), ""
+}
+
+// withHint appends hint, if any, to an apology.
+func withHint(out reply, hint string) reply {
+	if hint != "" {
+		out.Text += " " + hint
+	}
+	return out
+}
+
+// intentRegistry looks up intents by name or alias, ignoring case.
+type intentRegistry struct {
+	byName map[string]*intentSpec
+}
+
+// newIntentRegistry returns a registry holding specs. It panics if two
+// specs share a name or alias.
+func newIntentRegistry(specs ...intentSpec) *intentRegistry {
+	r := &intentRegistry{byName: make(map[string]*intentSpec)}
+	for _, spec := range specs {
+		r.Register(spec)
+	}
+	return r
+}
+
+// Register adds spec to the registry. It panics if its name or an alias is
+// already taken.
+func (r *intentRegistry) Register(spec intentSpec) {
+	s := &spec
+	for _, name := range append([]string{spec.Name}, spec.Aliases...) {
+		name = strings.ToUpper(name)
+		if _, ok := r.byName[name]; ok {
+			panic("intent " + name + " registered twice")
+		}
+		r.byName[name] = s
+	}
+}
+
+// Lookup returns the intent with the given name or alias.
+func (r *intentRegistry) Lookup(name string) (*intentSpec, bool) {
+	s, ok := r.byName[strings.ToUpper(name)]
+	return s, ok
+}
+
+// intents are the intents every front-end understands.
+var intents = newIntentRegistry(
+	intentSpec{Name: "ON", Aliases: []string{"TURNON", "POWERON"}, Undoable: true, Routes: on(deviceTV, func(ctx context.Context, room Room, req *IntentRequest) reply {
+		return setPower(ctx, room, true)
+	})},
+	intentSpec{Name: "OFF", Aliases: []string{"TURNOFF", "POWEROFF"}, Undoable: true, Routes: on(deviceTV, func(ctx context.Context, room Room, req *IntentRequest) reply {
+		return setPower(ctx, room, false)
+	})},
+	intentSpec{Name: "POWER", Undoable: true, Routes: on(deviceTV, func(ctx context.Context, room Room, req *IntentRequest) reply {
+		return setPower(ctx, room, !states.Get(room.ID).Power)
+	})},
+	// setMute and setVolume use the receiver when there is one.
+	intentSpec{Name: "MUTE", Undoable: true, Routes: audio(func(ctx context.Context, room Room, req *IntentRequest) reply {
+		return setMute(ctx, room, true)
+	})},
+	intentSpec{Name: "UNMUTE", Undoable: true, Routes: audio(func(ctx context.Context, room Room, req *IntentRequest) reply {
+		return setMute(ctx, room, false)
+	})},
+	intentSpec{
+		Name:     "VOLUME",
+		Slots:    []slotSpec{{Name: "Level", Type: slotNumber, Required: true, Noun: "volume level", Max: 100}},
+		Undoable: true,
+		Routes: audio(func(ctx context.Context, room Room, req *IntentRequest) reply {
+			level, _ := req.Slot("Level")
+			setVolume(ctx, room, level)
+			return acknowledged
+		}),
+	},
+	intentSpec{
+		Name:     "VOLUMEUP",
+		Aliases:  []string{"LOUDER"},
+		Slots:    []slotSpec{volumeStep},
+		Undoable: true,
+		Routes: audio(func(ctx context.Context, room Room, req *IntentRequest) reply {
+			return changeVolume(ctx, room, req, true)
+		}),
+	},
+	intentSpec{
+		Name:     "VOLUMEDOWN",
+		Aliases:  []string{"QUIETER"},
+		Slots:    []slotSpec{volumeStep},
+		Undoable: true,
+		Routes: audio(func(ctx context.Context, room Room, req *IntentRequest) reply {
+			return changeVolume(ctx, room, req, false)
+		}),
+	},
+	intentSpec{
+		Name:     "INPUT",
+		Slots:    []slotSpec{{Name: "InputType", Required: true}},
+		Undoable: true,
+		Routes:   on(deviceTV, switchInput),
+	},
+	intentSpec{Name: "UNDO", Handle: func(ctx context.Context, room Room, req *IntentRequest) reply {
+		return undo(ctx, room)
+	}},
+	intentSpec{Name: "STATUS", Handle: func(ctx context.Context, room Room, req *IntentRequest) reply {
+		return info(describeState(room, states.Get(room.ID)))
+	}},
+	intentSpec{
+		Name:    "CHANNEL",
+		Aliases: []string{"STATION"},
+		Slots:   []slotSpec{{Name: "Number", Type: slotChannel, Required: true, Noun: "channel"}},
+		Routes:  on(deviceTV, tuneChannel),
+	},
+	intentSpec{Name: "CHANNELUP", Aliases: []string{"NEXTCHANNEL"}, Slots: channelsSlot, Routes: on(deviceTV, tvPresses("ChannelUp", "Channels"))},
+	intentSpec{Name: "CHANNELDOWN", Aliases: []string{"PREVIOUSCHANNEL"}, Slots: channelsSlot, Routes: on(deviceTV, tvPresses("ChannelDown", "Channels"))},
+	intentSpec{Name: "HOME", Routes: remote("home", "Home")},
+	intentSpec{Name: "BACK", Routes: remote("back", "Back")},
+	intentSpec{Name: "UP", Slots: spacesSlot, Routes: move("up", "Up")},
+	intentSpec{Name: "DOWN", Slots: spacesSlot, Routes: move("down", "Down")},
+	intentSpec{Name: "LEFT", Slots: spacesSlot, Routes: move("left", "Left")},
+	intentSpec{Name: "RIGHT", Slots: spacesSlot, Routes: move("right", "Right")},
+	intentSpec{Name: "ENTER", Routes: remote("enter", "Enter")},
+	intentSpec{Name: "SELECT", Routes: remote("select", "Enter")},
+	intentSpec{Name: "PLAY", Routes: remote("right", "Play")},
+	intentSpec{Name: "FORWARD", Routes: remote("forward", "FastForward")},
+	intentSpec{Name: "REVERSE", Routes: remote("reverse", "Rewind")},
+	intentSpec{
+		Name:  "SEARCH",
+		Slots: []slotSpec{{Name: "SearchType", Required: true}},
+		Routes: on(deviceRoku, func(ctx context.Context, room Room, req *IntentRequest) reply {
+			query, _ := req.Slot("SearchType")
+			goAction(ctx, room.RokuActionHost, "search", query)
+			return acknowledged
+		}),
+	},
+	intentSpec{
+		Name:   "SLEEPTIMER",
+		Slots:  []slotSpec{{Name: "Duration", Required: true}},
+		Handle: setSleepTimer,
+	},
+	intentSpec{Name: "TIMELEFT", Handle: func(ctx context.Context, room Room, req *IntentRequest) reply {
+		return sleepTimerLeft(room)
+	}},
+	intentSpec{Name: "CANCELTIMER", Handle: func(ctx context.Context, room Room, req *IntentRequest) reply {
+		return cancelSchedules(ctx, room, false)
+	}},
+	intentSpec{
+		Name:   "SCHEDULE",
+		Slots:  []slotSpec{{Name: "Time", Required: true}, {Name: "Days"}},
+		Handle: addSchedule,
+	},
+	intentSpec{Name: "CANCELSCHEDULE", Handle: func(ctx context.Context, room Room, req *IntentRequest) reply {
+		return cancelSchedules(ctx, room, true)
+	}},
+)
+
+// spacesSlot is the optional repeat count of the navigation intents.
+var spacesSlot = []slotSpec{{Name: "Spaces", Type: slotNumber, Noun: "number of spaces", Min: 1, Max: 20}}
+
+// channelsSlot is the optional number of channels CHANNELUP and CHANNELDOWN
+// skip.
+var channelsSlot = []slotSpec{{Name: "Channels", Type: slotNumber, Noun: "number of channels", Min: 1, Max: maxSkipChannels}}
+
+// volumeStep is the optional step of VOLUMEUP and VOLUMEDOWN.
+var volumeStep = slotSpec{Name: "Amount", Type: slotNumber, Noun: "volume change", Min: 1, Max: 100}
+
+// on routes an intent to a single device.
+func on(d device, handle intentHandler) []intentRoute {
+	return []intentRoute{{Device: d, Handle: handle}}
+}
+
+// audio routes an intent to the receiver or, without one, the TV.
+func audio(handle intentHandler) []intentRoute {
+	return []intentRoute{{Device: deviceReceiver, Handle: handle}, {Device: deviceTV, Handle: handle}}
+}
+
+// remote routes an intent to a Roku command or, without a Roku, a TV key.
+func remote(rokuCommand, tvKey string) []intentRoute {
+	return []intentRoute{{Device: deviceRoku, Handle: rokuAction(rokuCommand)}, {Device: deviceTVRemote, Handle: tvAction(tvKey)}}
+}
+
+// move routes a navigation intent to the Roku or, without one, the TV's
+// arrow keys.
+func move(direction, tvKey string) []intentRoute {
+	return []intentRoute{{Device: deviceRoku, Handle: rokuMove(direction)}, {Device: deviceTVRemote, Handle: tvMove(tvKey)}}
+}
+
+// tvAction returns a handler sending command to the TV.
+func tvAction(command string) intentHandler {
+	return func(ctx context.Context, room Room, req *IntentRequest) reply {
+		goAction(ctx, room.TVActionHost, command, "")
+		return acknowledged
+	}
+}
+
+// rokuAction returns a handler sending command to the Roku.
+func rokuAction(command string) intentHandler {
+	return func(ctx context.Context, room Room, req *IntentRequest) reply {
+		goAction(ctx, room.RokuActionHost, command, "")
+		return acknowledged
+	}
+}
+
+// rokuMove returns a handler moving the Roku cursor by the Spaces slot,
+// one space by default.
+func rokuMove(direction string) intentHandler {
+	return func(ctx context.Context, room Room, req *IntentRequest) reply {
+		spaces, err := req.Slot("Spaces")
+		if err != nil {
+			spaces = "1"
+		}
+		goAction(ctx, room.RokuActionHost, direction, spaces)
+		return acknowledged
+	}
+}
+
+// tvMove returns a handler pressing a TV arrow key once per space in the
+// Spaces slot.
+func tvMove(key string) intentHandler {
+	return tvPresses(key, "Spaces")
+}
+
+// tvPresses returns a handler pressing a TV key as many times as the count
+// slot says, once by default. The TV takes one key per command, so presses
+// are sent in order from a single goroutine.
+func tvPresses(key, count string) intentHandler {
+	return func(ctx context.Context, room Room, req *IntentRequest) reply {
+		n := 1
+		if v, err := req.Slot(count); err == nil {
+			n, _ = strconv.Atoi(v)
+		}
+		background(ctx, func() {
+			for i := 0; i < n; i++ {
+				if executeAction(ctx, room.TVActionHost, key, "") != nil {
+					return
+				}
+			}
+		})
+		return acknowledged
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIntentRegistry_Lookup(t *testing.T) {
+	for name, want := range map[string]string{"ChannelUp": "CHANNELUP", "nextChannel": "CHANNELUP", "turnOff": "OFF", "VOLUME": "VOLUME"} {
+		spec, ok := intents.Lookup(name)
+		if !ok || spec.Name != want {
+			t.Errorf("Lookup(%q) = %v, %v; want %s", name, spec, ok, want)
+		}
+	}
+	if _, ok := intents.Lookup("Bogus"); ok {
+		t.Error("expected Bogus to be unknown")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a duplicate alias")
+		}
+	}()
+	newIntentRegistry(intentSpec{Name: "A", Aliases: []string{"B"}}, intentSpec{Name: "b"})
+}
+
+func TestServeIntent_Validation(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	}))
+	defer device.Close()
+	room := testRoom(device.URL, "", "")
+
+	tests := []struct {
+		intent string
+		slots  map[string]string
+		want   string
+	}{
+		{"HOME", nil, "I'm sorry, the Test Room doesn't have that."},
+		{"Search", map[string]string{"SearchType": "cartoons"}, "I'm sorry, the Test Room doesn't have that."},
+		{"VOLUME", nil, "I'm sorry, I couldn't set the volume. Say a volume level from 0 to 100."},
+		{"VOLUME", map[string]string{"Level": "loud"}, "I'm sorry, loud isn't a volume level I can use. Say a volume level from 0 to 100."},
+		{"VOLUME", map[string]string{"Level": "?"}, "I'm sorry, ? isn't a volume level I can use. Say a volume level from 0 to 100."},
+		{"Louder", map[string]string{"Amount": "-3"}, "I'm sorry, -3 isn't a volume change I can use. Say a volume change from 1 to 100."},
+		{"Channel", map[string]string{}, "I'm sorry, I couldn't change the channel. Say a channel number, like 5 or 5.1."},
+		{"Channel", map[string]string{"Number": "5.1.2"}, "I'm sorry, 5.1.2 isn't a channel I can use. Say a channel number, like 5 or 5.1."},
+	}
+	for _, tt := range tests {
+		resp := serveIntent(context.Background(), room, &IntentRequest{Intent: tt.intent, Slots: tt.slots})
+		if resp.Text() != tt.want || resp.Outcome != "error" {
+			t.Errorf("%s %v: %q (%s), want %q", tt.intent, tt.slots, resp.Text(), resp.Outcome, tt.want)
+		}
+	}
+	pending.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 0 {
+		t.Errorf("expected no device calls for rejected intents, got %d", calls)
+	}
+}
+
+func TestServeIntent_Routes(t *testing.T) {
+	var mu sync.Mutex
+	var tvCalls []string
+	tv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		tvCalls = append(tvCalls, string(body))
+		mu.Unlock()
+	}))
+	defer tv.Close()
+	room := testRoom(tv.URL, "", "")
+	room.Capabilities.TVRemote = true
+
+	if got := room.devices(); len(got) != 2 || got[0] != deviceTV || got[1] != deviceTVRemote {
+		t.Errorf("devices = %v", got)
+	}
+	for _, req := range []*IntentRequest{{Intent: "HOME"}, {Intent: "DOWN", Slots: map[string]string{"Spaces": "2"}}} {
+		if resp := serveIntent(context.Background(), room, req); resp.Outcome != "ok" {
+			t.Errorf("%s: %q", req.Intent, resp.Text())
+		}
+		pending.Wait()
+	}
+	if resp := serveIntent(context.Background(), room, &IntentRequest{Intent: "SEARCH", Slots: map[string]string{"SearchType": "news"}}); resp.Text() != "I'm sorry, the Test Room doesn't have that." {
+		t.Errorf("SEARCH without a Roku: %q", resp.Text())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{`{"command":"Home"}`, `{"command":"Down"}`, `{"command":"Down"}`}
+	if strings.Join(tvCalls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("TV calls = %v, want %v", tvCalls, want)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// listenConfig is where and how the Alexa endpoint is served.
+type listenConfig struct {
+	Addr       string   // host:port, default ":8000"
+	CertFile   string   // TLS certificate; with KeyFile enables HTTPS
+	KeyFile    string   // TLS private key
+	SelfSigned []string // hosts for a generated certificate; empty disables
+	PathPrefix string   // prefix a reverse proxy leaves on every path, e.g. "/alexa"
+}
+
+// listenConfigFromEnv reads LISTEN_ADDR, TLS_CERT_FILE, TLS_KEY_FILE,
+// TLS_SELF_SIGNED and PATH_PREFIX.
+func listenConfigFromEnv(getenv func(string) string) (listenConfig, error) {
+	c := listenConfig{
+		Addr:       getenv("LISTEN_ADDR"),
+		CertFile:   getenv("TLS_CERT_FILE"),
+		KeyFile:    getenv("TLS_KEY_FILE"),
+		PathPrefix: strings.TrimSuffix(getenv("PATH_PREFIX"), "/"),
+	}
+	if c.Addr == "" {
+		c.Addr = ":8000"
+	}
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		return c, fmt.Errorf("invalid LISTEN_ADDR %q: %w", c.Addr, err)
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return c, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if v := getenv("TLS_SELF_SIGNED"); v != "" {
+		for _, host := range strings.Split(v, ",") {
+			c.SelfSigned = append(c.SelfSigned, strings.TrimSpace(host))
+		}
+	}
+	if c.PathPrefix != "" && !strings.HasPrefix(c.PathPrefix, "/") {
+		return c, fmt.Errorf("PATH_PREFIX %q must start with /", c.PathPrefix)
+	}
+	return c, nil
+}
+
+// TLS reports whether the endpoint is served over HTTPS.
+func (c listenConfig) TLS() bool {
+	return c.CertFile != "" || len(c.SelfSigned) > 0
+}
+
+// server builds the HTTP server for handler, mounted under the path prefix
+// and with its certificate loaded or generated.
+func (c listenConfig) server(handler http.Handler) (*http.Server, error) {
+	if c.PathPrefix != "" {
+		handler = http.StripPrefix(c.PathPrefix, handler)
+	}
+	srv := newServer(c.Addr, handler)
+	if !c.TLS() {
+		return srv, nil
+	}
+
+	var cert tls.Certificate
+	var err error
+	if len(c.SelfSigned) > 0 {
+		cert, err = c.selfSigned()
+	} else {
+		cert, err = tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	return srv, nil
+}
+
+// selfSigned returns a certificate for the SelfSigned hosts. If cert and key
+// files are configured it reuses them when present and saves a new pair
+// otherwise, so the certificate uploaded to the Alexa console stays valid
+// across restarts.
+func (c listenConfig) selfSigned() (tls.Certificate, error) {
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return cert, err
+		}
+	}
+	certPEM, keyPEM, err := selfSignedCert(c.SelfSigned, time.Now())
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if c.CertFile != "" {
+		if err := os.WriteFile(c.CertFile, certPEM, 0o644); err != nil {
+			return tls.Certificate{}, err
+		}
+		if err := os.WriteFile(c.KeyFile, keyPEM, 0o600); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// selfSignedCert generates a PEM certificate and key valid for a year for
+// hosts, which may be names or IP addresses. The key is RSA, which the Alexa
+// console accepts for self-signed test endpoints.
+func selfSignedCert(hosts []string, now time.Time) (certPEM, keyPEM []byte, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"go-alexa-api"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// healthURL is the local URL the healthcheck subcommand probes.
+func (c listenConfig) healthURL() string {
+	host, port, _ := net.SplitHostPort(c.Addr)
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	scheme := "http"
+	if c.TLS() {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + c.PathPrefix + "/healthz"
+}
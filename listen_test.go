@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenConfigFromEnv(t *testing.T) {
+	env := func(m map[string]string) func(string) string {
+		return func(k string) string { return m[k] }
+	}
+
+	c, err := listenConfigFromEnv(env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Addr != ":8000" || c.TLS() || c.healthURL() != "http://localhost:8000/healthz" {
+		t.Errorf("defaults = %+v, health %s", c, c.healthURL())
+	}
+
+	c, err = listenConfigFromEnv(env(map[string]string{
+		"LISTEN_ADDR":     "127.0.0.1:8443",
+		"TLS_SELF_SIGNED": "localhost, 127.0.0.1",
+		"PATH_PREFIX":     "/alexa/",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.healthURL(); got != "https://127.0.0.1:8443/alexa/healthz" {
+		t.Errorf("healthURL = %s", got)
+	}
+	if len(c.SelfSigned) != 2 || c.SelfSigned[1] != "127.0.0.1" {
+		t.Errorf("SelfSigned = %q", c.SelfSigned)
+	}
+
+	for _, bad := range []map[string]string{
+		{"LISTEN_ADDR": "8000"},
+		{"TLS_CERT_FILE": "cert.pem"},
+		{"PATH_PREFIX": "alexa"},
+	} {
+		if _, err := listenConfigFromEnv(env(bad)); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
+
+func TestListenConfig_SelfSignedTLSWithPrefix(t *testing.T) {
+	dir := t.TempDir()
+	c := listenConfig{
+		Addr:       ":0",
+		CertFile:   filepath.Join(dir, "cert.pem"),
+		KeyFile:    filepath.Join(dir, "key.pem"),
+		SelfSigned: []string{"127.0.0.1"},
+		PathPrefix: "/alexa",
+	}
+	srv, err := c.server(newRouter(skills))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(srv.Handler)
+	ts.TLS = srv.TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	for path, want := range map[string]int{"/alexa/healthz": http.StatusOK, "/healthz": http.StatusNotFound} {
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+
+	// The generated pair is saved and reused on the next start.
+	saved, err := os.ReadFile(c.CertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.server(http.NotFoundHandler()); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, _ := os.ReadFile(c.CertFile)
+	if string(saved) != string(reloaded) {
+		t.Error("expected the saved certificate to be reused")
+	}
+}
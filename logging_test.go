@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newLogger(&buf, "warn", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("hidden")
+	l.Warn("shown", "k", "v")
+
+	if strings.Contains(buf.String(), "hidden") {
+		t.Error("info line logged at warn level")
+	}
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected one JSON line, got %q", buf.String())
+	}
+	if line["msg"] != "shown" || line["k"] != "v" {
+		t.Errorf("unexpected line: %v", line)
+	}
+
+	if _, err := newLogger(&buf, "loud", ""); err == nil {
+		t.Error("expected error for invalid level")
+	}
+	if _, err := newLogger(&buf, "", "xml"); err == nil {
+		t.Error("expected error for invalid format")
+	}
+}
+
+func TestLogger_FromContext(t *testing.T) {
+	if logger(context.Background()) != slog.Default() {
+		t.Error("expected default logger without context logger")
+	}
+}
+
+func TestServeIntent_RequestIDOnDeviceCalls(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := newLogger(&buf, "debug", "json")
+	saved := slog.Default()
+	slog.SetDefault(l)
+	defer slog.SetDefault(saved)
+
+	tv := &deviceRecorder{}
+	server := httptest.NewServer(tv)
+	defer server.Close()
+
+	room := testRoom(server.URL, "", "")
+	req := newIntentRequest("Channel", map[string]string{"Number": "3"})
+	req.Request.RequestID = "amzn1.echo-api.request.abc"
+	handleIntent(room)(req, alexa.NewResponse())
+	pending.Wait()
+
+	var sawDeviceCall, sawHeadersAtInfo bool
+	for _, raw := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var line map[string]any
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("invalid JSON log line %q", raw)
+		}
+		if line["request_id"] != "amzn1.echo-api.request.abc" || line["room"] != "test" || line["intent"] != "CHANNEL" {
+			t.Errorf("log line missing request fields: %v", line)
+		}
+		if line["msg"] == "device call" {
+			sawDeviceCall = true
+		}
+		if _, ok := line["headers"]; ok && line["level"] != "DEBUG" {
+			sawHeadersAtInfo = true
+		}
+	}
+	if !sawDeviceCall {
+		t.Errorf("no device call logged:\n%s", buf.String())
+	}
+	if sawHeadersAtInfo {
+		t.Error("response headers logged above debug level")
+	}
+}
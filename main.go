@@ -1,25 +1,151 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"log/slog"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
 
-	alexa "github.com/mikeflynn/go-alexa/skillserver"
+	"github.com/terickson/go-alexa-api/alexa"
 )
 
-var applications = map[string]interface{}{
-	"/echo/mbr": alexa.EchoApplication{
-		AppID:    os.Getenv("MBR_APP_ID"),
-		OnIntent: handleIntent(MasterBedroom),
-		OnLaunch: handleIntent(MasterBedroom),
-	},
-	"/echo/fr": alexa.EchoApplication{
-		AppID:    os.Getenv("FR_APP_ID"),
-		OnIntent: handleIntent(FamilyRoom),
-		OnLaunch: handleIntent(FamilyRoom),
-	},
+// skills are the Alexa endpoints, one skill per room. Request signatures
+// are only verified with VERIFY_SIGNATURES; by default the TLS-terminating
+// proxy in front is trusted.
+var skills = alexaSkills{
+	"/echo/mbr": roomSkill(os.Getenv("MBR_APP_ID"), MasterBedroom),
+	"/echo/fr":  roomSkill(os.Getenv("FR_APP_ID"), FamilyRoom),
 }
 
 func main() {
-	alexa.SetVerifyAWSCerts(false)
-	alexa.Run(applications, "8000")
+	l, err := newLogger(os.Stderr, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	if err != nil {
+		fatal("configuring logging", "err", err)
+	}
+	slog.SetDefault(l)
+
+	// Replies are configured before the subcommands, so simulate and replay
+	// speak as the server does.
+	if path := os.Getenv("RESPONSES_FILE"); path != "" {
+		if responses, err = LoadResponses(path); err != nil {
+			fatal("loading RESPONSES_FILE", "err", err)
+		}
+	}
+	if terse, _ := strconv.ParseBool(os.Getenv("TERSE_RESPONSES")); terse {
+		responses.Terse = true
+	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "simulate":
+			os.Exit(simulate(os.Args[2:], os.Stdout))
+		case "replay":
+			os.Exit(replay(os.Args[2:], os.Stdout))
+		case "healthcheck":
+			listen, err := listenConfigFromEnv(os.Getenv)
+			if err != nil {
+				fatal("configuring listener", "err", err)
+			}
+			target := listen.healthURL()
+			if len(os.Args) > 2 {
+				target = os.Args[2]
+			}
+			os.Exit(healthcheck(target))
+		}
+	}
+
+	dry := flag.Bool("dry-run", dryRunFromEnv(), "record device calls instead of sending them")
+	flag.Parse()
+	dryRun.Store(*dry)
+	if *dry {
+		slog.Info("dry-run mode: device calls will be recorded, not sent")
+	}
+
+	if tracer, err = newTracerFromEnv(os.Getenv, os.Stdout); err != nil {
+		fatal("configuring tracing", "err", err)
+	}
+
+	scheduleFile := os.Getenv("SCHEDULE_FILE")
+	if scheduleFile == "" {
+		scheduleFile = "schedules.json"
+	}
+	scheduler = NewScheduler(scheduleFile, func(roomID string) {
+		if room, ok := Rooms[roomID]; ok {
+			setPower(withLogger(context.Background(), "room", roomID, "source", "schedule"), room, false)
+		}
+	})
+	if err := scheduler.Load(); err != nil {
+		slog.Error("loading schedules", "err", err)
+	}
+
+	pollCtx, stopPolling := context.WithCancel(context.Background())
+	defer stopPolling()
+	if v := os.Getenv("STATE_POLL_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			fatal("invalid STATE_POLL_INTERVAL", "err", err)
+		}
+		go pollStates(pollCtx, interval)
+	}
+
+	if path := os.Getenv("CAPTURE_FILE"); path != "" {
+		if captureLog, err = OpenCaptureLog(path); err != nil {
+			fatal("opening CAPTURE_FILE", "err", err)
+		}
+	}
+
+	if verify, _ := strconv.ParseBool(os.Getenv("VERIFY_SIGNATURES")); verify {
+		verifier := &alexa.Verifier{}
+		for _, skill := range skills {
+			skill.Verifier = verifier
+		}
+	}
+
+	listen, err := listenConfigFromEnv(os.Getenv)
+	if err != nil {
+		fatal("configuring listener", "err", err)
+	}
+	frontends := []Frontend{skills}
+	if token := os.Getenv("SMART_HOME_TOKEN"); token != "" {
+		frontends = append(frontends, smartHomeFrontend{token: token})
+	}
+	if token := os.Getenv("WEBHOOK_TOKEN"); token != "" {
+		frontends = append(frontends, webhookFrontend{token: token})
+	}
+	srv, err := listen.server(newRouter(frontends...))
+	if err != nil {
+		fatal("configuring TLS", "err", err)
+	}
+	servers := []*http.Server{srv}
+	if addr := os.Getenv("ADMIN_ADDR"); addr != "" {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			fatal("ADMIN_TOKEN is required when ADMIN_ADDR is set")
+		}
+		servers = append(servers, newServer(addr, newAdminHandler(token)))
+	}
+
+	shutdownTimeout := 20 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		if shutdownTimeout, err = time.ParseDuration(v); err != nil {
+			fatal("invalid SHUTDOWN_TIMEOUT", "err", err)
+		}
+	}
+
+	stop := func() {
+		stopPolling()
+		scheduler.Stop()
+	}
+	if err := serve(shutdownTimeout, stop, servers...); err != nil {
+		fatal("shutdown", "err", err)
+	}
+}
+
+// fatal logs an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
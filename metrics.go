@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The metrics below are exposed at /metrics in the Prometheus text format.
+// They are small hand-rolled collectors rather than client_golang, which
+// would be most of the binary for a handful of series.
+var (
+	intentsTotal = newCounterVec("alexa_intents_total",
+		"Alexa intents handled, by room, intent (or unknown) and outcome.", "room", "intent", "outcome")
+	unresolvedInputsTotal = newCounterVec("alexa_unresolved_inputs_total",
+		"INPUT requests whose input type matched no alias and fell back to a Roku app.", "room")
+	deviceCallsTotal = newCounterVec("device_calls_total",
+		"Device bridge calls, by device, command and HTTP status (or error / dry_run).", "device", "command", "status")
+	deviceCallDuration = newHistogramVec("device_call_duration_seconds",
+		"Device bridge call latency by host.", []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 15}, "host")
+	deviceConsecutiveFailures = newGaugeVec("device_consecutive_failures",
+		"Failed calls in a row per device host; resets on success.", "host")
+	spansDroppedTotal = newCounterVec("trace_spans_dropped_total",
+		"Finished spans never exported, by reason (export_error, queue_full or shutdown).", "reason")
+)
+
+// metricsHandler serves every metric in the Prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range []interface{ writeTo(io.Writer) }{
+		intentsTotal, unresolvedInputsTotal, deviceCallsTotal, deviceCallDuration, deviceConsecutiveFailures,
+		spansDroppedTotal,
+	} {
+		m.writeTo(w)
+	}
+}
+
+// recordDeviceCall updates the device call metrics for one call. status is
+// the HTTP status code, or 0 if the request failed before a response.
+func recordDeviceCall(host, command string, status int, elapsed time.Duration) {
+	label := strconv.Itoa(status)
+	if status == 0 {
+		label = "error"
+	}
+	deviceCallsTotal.Add(1, deviceKind(host), command, label)
+	deviceCallDuration.Observe(elapsed.Seconds(), host)
+	if status >= 200 && status <= 299 {
+		deviceConsecutiveFailures.Set(0, host)
+	} else {
+		deviceConsecutiveFailures.Add(1, host)
+	}
+}
+
+// recordDryRunCall counts a device call that dry-run mode kept from being
+// sent.
+func recordDryRunCall(host, command string) {
+	deviceCallsTotal.Add(1, deviceKind(host), command, "dry_run")
+}
+
+// deviceKind names the kind of device a host belongs to in the room config.
+func deviceKind(host string) string {
+	_, kind := hostDevice(host)
+	return kind
+}
+
+// hostDevice finds the room and kind of device a host belongs to in the room
+// config. Rooms share the Roku bridge's address but not its path, so the
+// first match is the only one.
+func hostDevice(host string) (roomID, kind string) {
+	for _, room := range Rooms {
+		switch host {
+		case room.TVActionHost:
+			return room.ID, "tv"
+		case room.RokuActionHost:
+			return room.ID, "roku"
+		case room.ReceiverHost:
+			return room.ID, "receiver"
+		}
+	}
+	return "", "unknown"
+}
+
+// metricVec holds one value per label combination.
+type metricVec struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	kind   string
+	labels []string
+	values map[string]float64
+}
+
+type counterVec struct{ metricVec }
+
+type gaugeVec struct{ metricVec }
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{metricVec{name: name, help: help, kind: "counter", labels: labels, values: map[string]float64{}}}
+}
+
+func newGaugeVec(name, help string, labels ...string) *gaugeVec {
+	return &gaugeVec{metricVec{name: name, help: help, kind: "gauge", labels: labels, values: map[string]float64{}}}
+}
+
+// Add increases the counter for the given label values.
+func (c *counterVec) Add(v float64, labelValues ...string) {
+	c.add(v, labelValues)
+}
+
+// Add changes the gauge for the given label values by v.
+func (g *gaugeVec) Add(v float64, labelValues ...string) {
+	g.add(v, labelValues)
+}
+
+// Set sets the gauge for the given label values.
+func (g *gaugeVec) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[labelKey(labelValues)] = v
+}
+
+// Value returns the current value for the given label values.
+func (m *metricVec) Value(labelValues ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[labelKey(labelValues)]
+}
+
+func (m *metricVec) add(v float64, labelValues []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[labelKey(labelValues)] += v
+}
+
+func (m *metricVec) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	for _, key := range sortedKeys(m.values) {
+		fmt.Fprintf(w, "%s%s %s\n", m.name, formatLabels(m.labels, key, ""), formatValue(m.values[key]))
+	}
+}
+
+// histogramVec holds cumulative bucket counts per label combination.
+type histogramVec struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	buckets []float64
+	labels  []string
+	series  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, cumulative at write time
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, buckets: buckets, labels: labels, series: map[string]*histogram{}}
+}
+
+// Observe records one value for the given label values.
+func (h *histogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := labelKey(labelValues)
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, le := range h.buckets {
+		if v <= le {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count returns how many values were observed for the given label values.
+func (h *histogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[labelKey(labelValues)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *histogramVec) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, formatValue(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, key, ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key, ""), s.count)
+	}
+}
+
+// labelKey joins label values into a map key. The separator cannot appear
+// in Alexa slot values or URLs.
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels renders {name="value",...}, adding le when it is non-empty.
+func formatLabels(names []string, key, le string) string {
+	var pairs []string
+	if len(names) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, names[i]+"="+strconv.Quote(v))
+		}
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
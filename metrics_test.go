@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+func TestCounterVec_Exposition(t *testing.T) {
+	c := newCounterVec("test_total", "Test counter.", "room", "outcome")
+	c.Add(1, "fr", "ok")
+	c.Add(2, "fr", "ok")
+	c.Add(1, "mbr", `say "hi"`)
+
+	var b strings.Builder
+	c.writeTo(&b)
+	want := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{room="fr",outcome="ok"} 3
+test_total{room="mbr",outcome="say \"hi\""} 1
+`
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestHistogramVec_Exposition(t *testing.T) {
+	h := newHistogramVec("test_seconds", "Test histogram.", []float64{0.1, 1}, "host")
+	h.Observe(0.05, "a")
+	h.Observe(0.5, "a")
+	h.Observe(5, "a")
+
+	var b strings.Builder
+	h.writeTo(&b)
+	for _, want := range []string{
+		`test_seconds_bucket{host="a",le="0.1"} 1`,
+		`test_seconds_bucket{host="a",le="1"} 2`,
+		`test_seconds_bucket{host="a",le="+Inf"} 3`,
+		`test_seconds_sum{host="a"} 5.55`,
+		`test_seconds_count{host="a"} 3`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestMetrics_InstrumentedIntentAndDeviceCalls(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	room := testRoom(failing.URL, "", "")
+	handler := handleIntent(room)
+
+	okBefore := intentsTotal.Value("test", "CHANNELUP", "ok")
+	errBefore := intentsTotal.Value("test", "unknown", "error")
+	refusedBefore := intentsTotal.Value("test", "VOLUMEUP", "refused")
+	callsBefore := deviceCallsTotal.Value("unknown", "ChannelUp", "503")
+
+	handler(newIntentRequest("ChannelUp", nil), alexa.NewResponse())
+	handler(newIntentRequest("ChannelUp", nil), alexa.NewResponse())
+	handler(newIntentRequest("Bogus", nil), alexa.NewResponse())
+	handler(newIntentRequest("VolumeUp", nil), alexa.NewResponse()) // volume unknown
+	pending.Wait()
+
+	if got := intentsTotal.Value("test", "CHANNELUP", "ok") - okBefore; got != 2 {
+		t.Errorf("expected 2 ok CHANNELUP intents, got %v", got)
+	}
+	if got := intentsTotal.Value("test", "unknown", "error") - errBefore; got != 1 {
+		t.Errorf("expected 1 error BOGUS intent, got %v", got)
+	}
+	if got := intentsTotal.Value("test", "VOLUMEUP", "refused") - refusedBefore; got != 1 {
+		t.Errorf("expected 1 refused VOLUMEUP intent, got %v", got)
+	}
+	if got := deviceCallsTotal.Value("unknown", "ChannelUp", "503") - callsBefore; got != 2 {
+		t.Errorf("expected 2 failed device calls, got %v", got)
+	}
+	if got := deviceConsecutiveFailures.Value(failing.URL); got != 2 {
+		t.Errorf("expected 2 consecutive failures, got %v", got)
+	}
+	if got := deviceCallDuration.Count(failing.URL); got != 2 {
+		t.Errorf("expected 2 latency observations, got %d", got)
+	}
+
+	rec := httptest.NewRecorder()
+	metricsHandler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `alexa_intents_total{room="test",intent="unknown",outcome="error"}`) {
+		t.Errorf("intent counter missing from /metrics:\n%s", rec.Body.String())
+	}
+}
+
+func TestMetrics_UnresolvedInput(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+
+	room := testRoom(ok.URL, ok.URL, "")
+	before := unresolvedInputsTotal.Value("test")
+	handleIntent(room)(newIntentRequest("Input", map[string]string{"InputType": "pluto"}), alexa.NewResponse())
+	pending.Wait()
+
+	if got := unresolvedInputsTotal.Value("test") - before; got != 1 {
+		t.Errorf("expected 1 unresolved input, got %v", got)
+	}
+}
+
+func TestDeviceKind(t *testing.T) {
+	if got := deviceKind(FamilyRoom.ReceiverHost); got != "receiver" {
+		t.Errorf("expected receiver, got %s", got)
+	}
+	if got := deviceKind(MasterBedroom.RokuActionHost); got != "roku" {
+		t.Errorf("expected roku, got %s", got)
+	}
+	if got := deviceKind("http://elsewhere"); got != "unknown" {
+		t.Errorf("expected unknown, got %s", got)
+	}
+}
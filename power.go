@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+)
+
+// setPower turns the room's TV and, if present, its receiver on or off.
+func setPower(ctx context.Context, room Room, on bool) reply {
+	out := acknowledged
+	if !room.Capabilities.TVDiscretePower && !states.Get(room.ID).Known() {
+		out = refused("I don't know whether the " + room.Name + " TV is on, so I left it alone.")
+	} else if on {
+		powerOnTV(ctx, room)
+	} else if room.Capabilities.TVDiscretePower || needsToggle(room, func(s RoomState) bool { return s.Power }, false) {
+		command := "PowerOff"
+		if !room.Capabilities.TVDiscretePower {
+			command = "Power"
+		}
+		track(ctx, room, func() error { return executeAction(ctx, room.TVActionHost, command, "") },
+			func(s *RoomState) { s.Power = false })
+	}
+
+	if room.ReceiverHost != "" {
+		goReceiver(ctx, room.ReceiverHost, map[string]any{"on": on})
+	}
+	return out
+}
+
+// powerOnTV turns the TV on, sending a Power toggle only if it is tracked as
+// off.
+func powerOnTV(ctx context.Context, room Room) {
+	command := "PowerOn"
+	if !room.Capabilities.TVDiscretePower {
+		if !needsToggle(room, func(s RoomState) bool { return s.Power }, true) {
+			if !states.Get(room.ID).Known() {
+				logger(ctx).Warn("TV power unknown; not toggling", "room", room.ID)
+			}
+			return
+		}
+		command = "Power"
+	}
+	track(ctx, room, func() error { return executeAction(ctx, room.TVActionHost, command, "") },
+		func(s *RoomState) { s.Power = true })
+}
+
+// setMute mutes or unmutes the room. The receiver takes a discrete mute
+// setting; the TV is sent MuteOn/MuteOff if it supports them, otherwise a
+// Mute toggle unless the tracked mute state says it isn't needed.
+func setMute(ctx context.Context, room Room, mute bool) reply {
+	update := func(s *RoomState) {
+		s.Muted = mute
+		s.MuteKnown = true
+	}
+	if room.ReceiverHost != "" {
+		body := map[string]any{"mute": mute}
+		track(ctx, room, func() error { return updateReceiver(ctx, room.ReceiverHost, body) }, update)
+		return acknowledged
+	}
+
+	if room.Capabilities.TVDiscreteMute {
+		command := "MuteOff"
+		if mute {
+			command = "MuteOn"
+		}
+		track(ctx, room, func() error { return executeAction(ctx, room.TVActionHost, command, "") }, update)
+		return acknowledged
+	}
+
+	// Without a tracked mute state the toggle is assumed to be needed, as
+	// it usually is: a TV is rarely muted when asked to mute.
+	if st := states.Get(room.ID); st.MuteKnown && st.Muted == mute {
+		if mute {
+			return info("The " + room.Name + " is already muted.")
+		}
+		return info("The " + room.Name + " isn't muted.")
+	}
+	track(ctx, room, func() error { return executeAction(ctx, room.TVActionHost, "Mute", "") }, update)
+	return acknowledged
+}
+
+// needsToggle reports whether a toggle must be sent to reach want. It never
+// does for a room whose state hasn't been tracked, where a toggle could just
+// as well undo what was asked.
+func needsToggle(room Room, get func(RoomState) bool, want bool) bool {
+	st := states.Get(room.ID)
+	return st.Known() && get(st) != want
+}
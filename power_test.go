@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+// deviceRecorder is a fake device bridge that records request bodies.
+type deviceRecorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *deviceRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.calls = append(r.calls, string(body))
+	r.mu.Unlock()
+}
+
+func (r *deviceRecorder) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func TestSetPower_ToggleTV(t *testing.T) {
+	tv := &deviceRecorder{}
+	server := httptest.NewServer(tv)
+	defer server.Close()
+
+	room := testRoom(server.URL, "", "")
+	room.Capabilities = Capabilities{}
+
+	// Unknown state: a toggle could turn the TV on, so none is sent.
+	if got := setPower(context.Background(), room, false); got != refused("I don't know whether the Test Room TV is on, so I left it alone.") {
+		t.Errorf("unexpected reply for unknown state: %+v", got)
+	}
+	states.Update(room.ID, func(s *RoomState) { s.Power = true })
+	setPower(context.Background(), room, false)
+	pending.Wait()
+	// Known off: a second OFF must not toggle the TV back on.
+	setPower(context.Background(), room, false)
+	pending.Wait()
+	setPower(context.Background(), room, true)
+	pending.Wait()
+
+	calls := tv.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 Power toggles, got %d: %v", len(calls), calls)
+	}
+	for _, c := range calls {
+		if c != `{"command":"Power"}` {
+			t.Errorf("unexpected TV call: %s", c)
+		}
+	}
+	if !states.Get(room.ID).Power {
+		t.Error("expected room to be tracked as on")
+	}
+}
+
+func TestSetMute_DiscreteTV(t *testing.T) {
+	tv := &deviceRecorder{}
+	server := httptest.NewServer(tv)
+	defer server.Close()
+
+	room := testRoom(server.URL, "", "")
+	room.Capabilities.TVDiscreteMute = true
+
+	setMute(context.Background(), room, true)
+	pending.Wait()
+	setMute(context.Background(), room, true)
+	pending.Wait()
+	setMute(context.Background(), room, false)
+	pending.Wait()
+
+	want := []string{`{"command":"MuteOn"}`, `{"command":"MuteOn"}`, `{"command":"MuteOff"}`}
+	calls := tv.Calls()
+	if len(calls) != len(want) {
+		t.Fatalf("expected %d calls, got %v", len(want), calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d: got %s, want %s", i, calls[i], want[i])
+		}
+	}
+}
+
+func TestHandleIntent_UNMUTE_ToggleTV_AlreadyUnmuted(t *testing.T) {
+	tv := &deviceRecorder{}
+	server := httptest.NewServer(tv)
+	defer server.Close()
+
+	room := testRoom(server.URL, "", "")
+	states.Update(room.ID, func(s *RoomState) { s.Power = true; s.MuteKnown = true })
+	handler := handleIntent(room)
+
+	resp := alexa.NewResponse()
+	handler(newEchoRequest("UNMUTE", nil), resp)
+	pending.Wait()
+
+	if speechText(resp) != "The Test Room isn't muted." {
+		t.Errorf("unexpected output: %s", speechText(resp))
+	}
+	if len(tv.Calls()) != 0 {
+		t.Errorf("expected no TV calls, got %v", tv.Calls())
+	}
+}
+
+func TestHandleIntent_UNMUTE_ToggleTV_MuteUnknown(t *testing.T) {
+	tv := &deviceRecorder{}
+	server := httptest.NewServer(tv)
+	defer server.Close()
+
+	// Power is tracked but mute isn't, so the toggle is sent.
+	room := testRoom(server.URL, "", "")
+	states.Update(room.ID, func(s *RoomState) { s.Power = true })
+	handler := handleIntent(room)
+
+	handler(newEchoRequest("UNMUTE", nil), alexa.NewResponse())
+	pending.Wait()
+
+	if calls := tv.Calls(); len(calls) != 1 || calls[0] != `{"command":"Mute"}` {
+		t.Errorf("expected one Mute toggle, got %v", calls)
+	}
+	if st := states.Get(room.ID); !st.MuteKnown || st.Muted {
+		t.Errorf("expected room to be tracked as unmuted, got %+v", st)
+	}
+}
+
+func TestHandleIntent_POWER_Toggles(t *testing.T) {
+	tv := &deviceRecorder{}
+	server := httptest.NewServer(tv)
+	defer server.Close()
+
+	room := testRoom(server.URL, "", "")
+	states.Update(room.ID, func(s *RoomState) { s.Power = true })
+	handler := handleIntent(room)
+
+	handler(newEchoRequest("Power", nil), alexa.NewResponse())
+	pending.Wait()
+	handler(newEchoRequest("Power", nil), alexa.NewResponse())
+	pending.Wait()
+
+	calls := tv.Calls()
+	if len(calls) != 2 || calls[0] != `{"command":"PowerOff"}` || calls[1] != `{"command":"PowerOn"}` {
+		t.Errorf("unexpected TV calls: %v", calls)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+// directives sends progressive responses, only ever to Amazon's API
+// endpoints; tests allow a fake one.
+var directives = &alexa.DirectiveClient{}
+
+// sendProgressive has the Echo say speech while a long sequence runs, so
+// the user hears something before Alexa's 8 second timeout. The returned
+// channel is closed once the directive has been sent or has failed; wait on
+// it before responding, as Alexa drops progressive responses that arrive
+// after the final one.
+func sendProgressive(ctx context.Context, echoReq *alexa.RequestEnvelope, speech string) <-chan struct{} {
+	done := make(chan struct{})
+	if echoReq.Context.System.APIAccessToken == "" {
+		// Simulated and replayed requests have nowhere to send it.
+		close(done)
+		return done
+	}
+	if endpoint := echoReq.Context.System.APIEndpoint; !directives.Allows(endpoint) {
+		// The endpoint comes from the request; never send the token elsewhere.
+		logger(ctx).Warn("progressive response skipped: untrusted API endpoint", "endpoint", endpoint)
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		ctx, span := startSpan(ctx, "progressive response", spanClient, "device", "alexa", "command", "VoicePlayer.Speak")
+		defer span.End()
+		if err := directives.Speak(ctx, echoReq, speech); err != nil {
+			span.SetError(err)
+			logger(ctx).Warn("progressive response failed", "err", err)
+		}
+	}()
+	return done
+}
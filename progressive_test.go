@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInput_SendsProgressiveResponse(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer device.Close()
+	room := testRoom(device.URL, device.URL, device.URL)
+
+	var got struct {
+		Header    struct{ RequestID string }
+		Directive struct{ Type, Speech string }
+	}
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer service.Close()
+	directives.Endpoints = []string{service.URL}
+	defer func() { directives.Endpoints = nil }()
+
+	echoReq := newEchoRequest("INPUT", map[string]string{"InputType": "netflix"})
+	echoReq.Request.RequestID = "req-1"
+	echoReq.Context.System.APIEndpoint = service.URL
+	echoReq.Context.System.APIAccessToken = "token"
+	resp := serveIntent(context.Background(), room, alexaIntentRequest(echoReq))
+	pending.Wait()
+
+	if got.Header.RequestID != "req-1" || got.Directive.Type != "VoicePlayer.Speak" {
+		t.Errorf("directive not sent before the response: %+v", got)
+	}
+	if want := "Switching the test room to Netflix…"; got.Directive.Speech != want {
+		t.Errorf("speech = %q, want %q", got.Directive.Speech, want)
+	}
+	if resp.Text() != "The Test Room is on Netflix." {
+		t.Errorf("final speech = %q", resp.Text())
+	}
+}
+
+func TestInput_NoDirectiveService(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer device.Close()
+	room := testRoom(device.URL, device.URL, device.URL)
+
+	resp := serveIntent(context.Background(), room, alexaIntentRequest(newEchoRequest("INPUT", map[string]string{"InputType": "netflix"})))
+	pending.Wait()
+	if resp.Text() != "The Test Room is on Netflix." {
+		t.Errorf("final speech = %q", resp.Text())
+	}
+}
+
+func TestInput_UntrustedDirectiveService(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer device.Close()
+	room := testRoom(device.URL, device.URL, device.URL)
+
+	var contacted atomic.Bool
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contacted.Store(true)
+	}))
+	defer foreign.Close()
+
+	echoReq := newEchoRequest("INPUT", map[string]string{"InputType": "netflix"})
+	echoReq.Context.System.APIEndpoint = foreign.URL
+	echoReq.Context.System.APIAccessToken = "token"
+	resp := serveIntent(context.Background(), room, alexaIntentRequest(echoReq))
+	pending.Wait()
+
+	if contacted.Load() {
+		t.Error("the access token was sent to a foreign API endpoint")
+	}
+	if resp.Text() != "The Test Room is on Netflix." {
+		t.Errorf("final speech = %q", resp.Text())
+	}
+}
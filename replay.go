@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// replay runs every request in a capture log through the handlers against
+// dry-run devices and reports where the speech or device calls differ from
+// what was recorded. It returns the process exit code.
+func replay(args []string, out io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(out, "usage: go-alexa-api replay FILE.jsonl")
+		return 2
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	defer f.Close()
+
+	mismatches, err := replayRecords(f, out)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	if mismatches > 0 {
+		return 1
+	}
+	return 0
+}
+
+// replayRecords replays a capture log from a fresh server state and returns
+// the number of requests whose results differ from the recording. Replies
+// render with the process's response templates, and where a template has
+// variants the one recorded is chosen, so random picks don't show up as
+// differences.
+func replayRecords(r io.Reader, out io.Writer) (int, error) {
+	dir, err := os.MkdirTemp("", "replay")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	var recorded string
+	replies := *responses
+	replies.pick = func(rendered []string) int {
+		for i, speech := range rendered {
+			if plainText(speech) == recorded {
+				return i
+			}
+		}
+		return 0
+	}
+
+	savedStates, savedHistory, savedScheduler, savedResponses := states, history, scheduler, responses
+	states = NewStateStore()
+	history = NewHistory(historyLimit)
+	scheduler = NewScheduler(filepath.Join(dir, "schedules.json"), func(string) {})
+	responses = &replies
+	defer func() {
+		states, history, scheduler, responses = savedStates, savedHistory, savedScheduler, savedResponses
+	}()
+	// Only the replayed requests are dry runs; calls are compared through
+	// each request's own record, so the log is never read.
+	base := withDryRun(context.Background(), NewCallLog(dryRunLimit))
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	mismatches := 0
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec capturedRequest
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return mismatches, fmt.Errorf("line %d: %w", line, err)
+		}
+		room, ok := Rooms[rec.Room]
+		if !ok || rec.Request == nil {
+			return mismatches, fmt.Errorf("line %d: unknown room %q or missing request", line, rec.Room)
+		}
+
+		recorded = rec.Speech
+		ctx, rc := withRequestCalls(base)
+		resp := serveIntent(ctx, room, alexaIntentRequest(rec.Request))
+		calls := rc.Wait()
+
+		diffs := diffReplay(rec, resp.Text(), calls)
+		if len(diffs) == 0 {
+			fmt.Fprintf(out, "line %d: ok %s %s\n", line, rec.Room, rec.Request.IntentName())
+			continue
+		}
+		mismatches++
+		fmt.Fprintf(out, "line %d: MISMATCH %s %s\n", line, rec.Room, rec.Request.IntentName())
+		for _, d := range diffs {
+			fmt.Fprintln(out, "  "+d)
+		}
+	}
+	return mismatches, scanner.Err()
+}
+
+// diffReplay describes how a replayed result differs from the recording.
+// Device calls are compared without regard to order, since they are made
+// concurrently.
+func diffReplay(rec capturedRequest, speech string, calls []DeviceCall) []string {
+	var diffs []string
+	if speech != rec.Speech {
+		diffs = append(diffs, fmt.Sprintf("speech: recorded %q, replayed %q", rec.Speech, speech))
+	}
+
+	want := callKeys(rec.Calls)
+	got := callKeys(calls)
+	for i, j := 0, 0; i < len(want) || j < len(got); {
+		switch {
+		case j == len(got) || (i < len(want) && want[i] < got[j]):
+			diffs = append(diffs, "- "+want[i])
+			i++
+		case i == len(want) || got[j] < want[i]:
+			diffs = append(diffs, "+ "+got[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return diffs
+}
+
+// callKeys renders calls as sorted "METHOD URL BODY" strings.
+func callKeys(calls []DeviceCall) []string {
+	keys := make([]string, len(calls))
+	for i, c := range calls {
+		keys[i] = c.Method + " " + c.URL + " " + c.Body
+	}
+	sort.Strings(keys)
+	return keys
+}
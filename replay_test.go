@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestReplayTestdata replays every capture log in testdata and fails on any
+// difference from the recorded speech or device calls.
+func TestReplayTestdata(t *testing.T) {
+	files, _ := filepath.Glob("testdata/*.jsonl")
+	if len(files) == 0 {
+		t.Fatal("no capture logs in testdata")
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			f, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			var out bytes.Buffer
+			mismatches, err := replayRecords(f, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mismatches != 0 {
+				t.Errorf("%d mismatches:\n%s", mismatches, out.String())
+			}
+		})
+	}
+}
+
+func TestReplay_ReportsMismatch(t *testing.T) {
+	line := `{"room":"mbr","request":{"request":{"type":"IntentRequest","intent":{"name":"Channel","slots":{"Number":{"name":"Number","value":"5"}}}}},` +
+		`"speech":"Done.","calls":[{"method":"POST","url":"` + MasterBedroom.TVActionHost + `","body":"{\"command\":\"Channel\",\"value\":\"6\"}"}]}`
+
+	var out bytes.Buffer
+	mismatches, err := replayRecords(strings.NewReader(line), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mismatches != 1 {
+		t.Fatalf("expected 1 mismatch, got %d", mismatches)
+	}
+	for _, want := range []string{
+		`speech: recorded "Done.", replayed "Okay."`,
+		`- POST ` + MasterBedroom.TVActionHost + ` {"command":"Channel","value":"6"}`,
+		`+ POST ` + MasterBedroom.TVActionHost + ` {"command":"Channel","value":"5"}`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestReplay_MatchesRecordedVariant(t *testing.T) {
+	saved := responses
+	defer func() { responses = saved }()
+	custom := mustResponses(NewResponses(map[string][]string{"ok": {"Okay.", "Done.", "You got it."}}))
+	responses = custom
+
+	line := `{"room":"mbr","request":{"request":{"type":"IntentRequest","intent":{"name":"Channel","slots":{"Number":{"name":"Number","value":"5"}}}}},` +
+		`"speech":"You got it.","calls":[{"method":"POST","url":"` + MasterBedroom.TVActionHost + `","body":"{\"command\":\"Channel\",\"value\":\"5\"}"}]}`
+	for range 10 {
+		var out bytes.Buffer
+		if mismatches, err := replayRecords(strings.NewReader(line), &out); err != nil || mismatches != 0 {
+			t.Fatalf("%d mismatches, %v:\n%s", mismatches, err, out.String())
+		}
+	}
+	if responses != custom {
+		t.Error("replay left its own responses in place")
+	}
+}
+
+func TestReplay_LeavesLiveCallsLive(t *testing.T) {
+	var live atomic.Int32
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		live.Add(1)
+	}))
+	defer device.Close()
+	dryRunCalls.Reset()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f, err := os.Open("testdata/captured.jsonl")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer f.Close()
+		replayRecords(f, &bytes.Buffer{})
+	}()
+	for range 20 {
+		if err := executeAction(context.Background(), device.URL, "Home", ""); err != nil {
+			t.Errorf("live call failed: %v", err)
+		}
+	}
+	<-done
+
+	if n := live.Load(); n != 20 {
+		t.Errorf("expected 20 live calls to reach the device, got %d", n)
+	}
+	if calls := dryRunCalls.Calls(); len(calls) != 0 {
+		t.Errorf("replay recorded into the process-wide dry-run log: %v", calls)
+	}
+}
+
+func TestReplay_Usage(t *testing.T) {
+	var out bytes.Buffer
+	if code := replay(nil, &out); code != 2 {
+		t.Errorf("expected exit code 2, got %d", code)
+	}
+	if code := replay([]string{"testdata/missing.jsonl"}, &out); code != 1 {
+		t.Errorf("expected exit code 1 for missing file, got %d", code)
+	}
+}
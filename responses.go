@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// acknowledged is what a handler returns when it has nothing to say beyond
+// "done"; the ok template decides what is spoken.
+var acknowledged = reply{Outcome: outcomeOK}
+
+// defaultTemplates are the built-in response phrases, by template key.
+var defaultTemplates = map[string][]string{
+	"ok":        {"Okay."},
+	"ON.ok":     {"Turning on the {{.Room}}."},
+	"OFF.ok":    {"Turning off the {{.Room}}."},
+	"INPUT.ok":  {"The {{.Room}} is on {{.Input}}."},
+	"VOLUME.ok": {"Setting the {{.Room}} volume to {{.Volume}}."},
+	"info":      {"{{.Message}}"},
+	"error":     {"{{.Message}}"},
+	"terse":     {`<audio src="soundbank://soundlibrary/ui/gameshow/amzn_ui_sfx_gameshow_positive_response_01"/>`},
+}
+
+// intentActions is how an intent is described in error messages.
+var intentActions = map[string]string{
+	"VOLUME":     "set the volume",
+	"VOLUMEUP":   "turn the volume up",
+	"VOLUMEDOWN": "turn the volume down",
+	"CHANNEL":    "change the channel",
+	"INPUT":      "switch the input",
+	"SEARCH":     "search for that",
+	"SLEEPTIMER": "set a sleep timer",
+	"SCHEDULE":   "set that schedule",
+}
+
+// Responses renders what Alexa says for each handled intent. Templates are
+// keyed "[room/][INTENT.]outcome", where outcome is ok (the handler only
+// acknowledged), info (it has something to report) or error; the most
+// specific key wins. A key's variants are chosen at random.
+type Responses struct {
+	// Terse answers ok outcomes with the "terse" template, a short sound by
+	// default, instead of speech.
+	Terse     bool
+	templates map[string][]*template.Template
+	pick      func(rendered []string) int // chooses among a key's rendered variants
+}
+
+// responseVars are the variables templates can use. Message is the
+// handler's own reply; the rest describe the room and request.
+type responseVars struct {
+	Room    string
+	Intent  string
+	Action  string
+	Input   string
+	Volume  string
+	Message string
+}
+
+// responses is the process-wide template set.
+var responses = mustResponses(NewResponses(nil))
+
+// defaultResponses renders with the built-in templates when an override
+// fails to.
+var defaultResponses = mustResponses(NewResponses(nil))
+
+// sampleVars fill every variable when templates are checked at load time.
+var sampleVars = responseVars{Room: "Room", Intent: "INTENT", Action: "do that", Input: "Input", Volume: "30", Message: "Message."}
+
+// responsesFile is the JSON layout of RESPONSES_FILE.
+type responsesFile struct {
+	Terse     bool                `json:"terse"`
+	Templates map[string][]string `json:"templates"`
+}
+
+// NewResponses returns the default templates with overrides replacing
+// whole keys.
+func NewResponses(overrides map[string][]string) (*Responses, error) {
+	r := &Responses{templates: make(map[string][]*template.Template), pick: pickAtRandom}
+	for _, set := range []map[string][]string{defaultTemplates, overrides} {
+		for key, variants := range set {
+			if len(variants) == 0 {
+				return nil, fmt.Errorf("template %q has no variants", key)
+			}
+			parsed := make([]*template.Template, len(variants))
+			for i, v := range variants {
+				t, err := template.New(key).Option("missingkey=error").Parse(v)
+				if err != nil {
+					return nil, err
+				}
+				// Render once with sample values, so a broken template
+				// fails at startup rather than on a request.
+				if err := t.Execute(io.Discard, sampleVars); err != nil {
+					return nil, err
+				}
+				parsed[i] = t
+			}
+			r.templates[key] = parsed
+		}
+	}
+	return r, nil
+}
+
+// LoadResponses reads template overrides from a JSON file such as
+// {"terse": false, "templates": {"fr/INPUT.ok": ["Enjoy {{.Input}}."]}}.
+func LoadResponses(path string) (*Responses, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f responsesFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r, err := NewResponses(f.Templates)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r.Terse = f.Terse
+	return r, nil
+}
+
+func mustResponses(r *Responses, err error) *Responses {
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// responseOutcome picks the template outcome for a handler's reply. A
+// refusal is spoken as information.
+func responseOutcome(out reply) string {
+	switch {
+	case out.Outcome == outcomeError:
+		return "error"
+	case out.Text == "":
+		return "ok"
+	}
+	return "info"
+}
+
+// Render returns the SSML for a reply in a room.
+func (r *Responses) Render(room Room, intent string, out reply, vars responseVars) string {
+	outcome := responseOutcome(out)
+	keys := []string{room.ID + "/" + intent + "." + outcome, intent + "." + outcome, room.ID + "/" + outcome, outcome}
+	if r.Terse && outcome == "ok" {
+		keys = []string{room.ID + "/terse", "terse"}
+	}
+
+	for _, key := range keys {
+		variants := r.templates[key]
+		if len(variants) == 0 {
+			continue
+		}
+		rendered := make([]string, len(variants))
+		for i, t := range variants {
+			var b strings.Builder
+			if err := t.Execute(&b, vars.escaped()); err != nil {
+				slog.Error("rendering response", "template", key, "err", err)
+				if r != defaultResponses {
+					return defaultResponses.Render(room, intent, out, vars)
+				}
+				return "<speak>" + escapeSSML(out.Text) + "</speak>"
+			}
+			rendered[i] = "<speak>" + b.String() + "</speak>"
+		}
+		return rendered[r.pick(rendered)]
+	}
+	return "<speak>" + escapeSSML(out.Text) + "</speak>"
+}
+
+func pickAtRandom(rendered []string) int {
+	return rand.IntN(len(rendered))
+}
+
+// escaped returns vars with every value safe to put in SSML text.
+func (v responseVars) escaped() responseVars {
+	return responseVars{
+		Room:    escapeSSML(v.Room),
+		Intent:  escapeSSML(v.Intent),
+		Action:  escapeSSML(v.Action),
+		Input:   escapeSSML(v.Input),
+		Volume:  escapeSSML(v.Volume),
+		Message: escapeSSML(v.Message),
+	}
+}
+
+var ssmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func escapeSSML(s string) string {
+	return ssmlEscaper.Replace(s)
+}
+
+var ssmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// plainText strips the markup from SSML for cards, logs and captures.
+func plainText(ssml string) string {
+	return strings.TrimSpace(html.UnescapeString(ssmlTag.ReplaceAllString(ssml, "")))
+}
+
+// intentAction describes an intent for error messages.
+func intentAction(intent string) string {
+	if action, ok := intentActions[intent]; ok {
+		return action
+	}
+	return "do that"
+}
+
+// sorry is the error reply for an intent that could not be carried out.
+func sorry(intent string) reply {
+	return failed("I'm sorry, I couldn't " + intentAction(intent) + ".")
+}
+
+// responseVarsFor collects the template variables for a request.
+func responseVarsFor(room Room, intent string, req *IntentRequest, out reply) responseVars {
+	vars := responseVars{Room: room.Name, Intent: intent, Action: intentAction(intent), Message: out.Text}
+	if slotInputType, err := req.Slot("InputType"); err == nil && slotInputType != "" {
+		vars.Input = inputName(room, aliasKey(slotInputType), slotInputType)
+	}
+	if slotLevel, err := req.Slot("Level"); err == nil && slotLevel != "" {
+		vars.Volume = slotLevel
+	} else if st := states.Get(room.ID); st.VolumeKnown {
+		vars.Volume = strconv.Itoa(st.Volume)
+	}
+	return vars
+}
+
+// inputName is how an input is spoken and shown: its Roku app, its screen
+// label, or else what the user said.
+func inputName(room Room, inputType, said string) string {
+	cfg, ok := room.InputMap[inputType]
+	if !ok {
+		return said
+	}
+	if cfg.RokuApp != "" {
+		return cfg.RokuApp
+	}
+	if name, ok := screenInputNames[inputType]; ok {
+		return name
+	}
+	for key, name := range screenInputNames {
+		if other, ok := room.InputMap[key]; ok && other == cfg {
+			return name
+		}
+	}
+	return said
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+)
+
+func TestResponses_Lookup(t *testing.T) {
+	r, err := NewResponses(map[string][]string{
+		"fr/INPUT.ok": {"Enjoy {{.Input}}."},
+		"mbr/ok":      {"Done in the {{.Room}}."},
+		"error":       {"Sorry, I couldn't {{.Action}} in the {{.Room}}."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := responseVars{Room: "Family Room", Input: "Netflix", Action: "switch the input"}
+	tests := []struct {
+		room   Room
+		intent string
+		out    reply
+		want   string
+	}{
+		{FamilyRoom, "INPUT", acknowledged, "<speak>Enjoy Netflix.</speak>"},
+		{MasterBedroom, "INPUT", acknowledged, "<speak>The Family Room is on Netflix.</speak>"},
+		{MasterBedroom, "MUTE", acknowledged, "<speak>Done in the Family Room.</speak>"},
+		{FamilyRoom, "MUTE", acknowledged, "<speak>Okay.</speak>"},
+		{FamilyRoom, "INPUT", sorry("INPUT"), "<speak>Sorry, I couldn't switch the input in the Family Room.</speak>"},
+		{FamilyRoom, "STATUS", info("The Family Room is off."), "<speak>The Family Room is off.</speak>"},
+		{FamilyRoom, "VOLUMEUP", refused("I don't know the current volume in the Family Room."), "<speak>I don't know the current volume in the Family Room.</speak>"},
+	}
+	for _, tt := range tests {
+		v := vars
+		v.Message = tt.out.Text
+		if got := r.Render(tt.room, tt.intent, tt.out, v); got != tt.want {
+			t.Errorf("%s %s %+v: got %s, want %s", tt.room.ID, tt.intent, tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestResponses_VariantsAndTerse(t *testing.T) {
+	r, err := NewResponses(map[string][]string{"ok": {"Okay.", "Done.", "You got it."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.pick = func(rendered []string) int { return len(rendered) - 1 }
+	if got := r.Render(FamilyRoom, "MUTE", acknowledged, responseVars{}); got != "<speak>You got it.</speak>" {
+		t.Errorf("got %s", got)
+	}
+
+	r.Terse = true
+	if got := plainText(r.Render(FamilyRoom, "MUTE", acknowledged, responseVars{})); got != "" {
+		t.Errorf("terse ok should be a sound, got %q", got)
+	}
+	if got := r.Render(FamilyRoom, "STATUS", info("The Family Room is off."), responseVars{Message: "The Family Room is off."}); got != "<speak>The Family Room is off.</speak>" {
+		t.Errorf("terse mode should still speak information, got %s", got)
+	}
+}
+
+func TestResponses_EscapesVariables(t *testing.T) {
+	got := responses.Render(FamilyRoom, "INPUT", acknowledged, responseVars{Room: "Family Room", Input: "Tom & Jerry <HD>"})
+	if want := "<speak>The Family Room is on Tom &amp; Jerry &lt;HD&gt;.</speak>"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if plainText(got) != "The Family Room is on Tom & Jerry <HD>." {
+		t.Errorf("plainText = %q", plainText(got))
+	}
+}
+
+func TestLoadResponses(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	os.WriteFile(good, []byte(`{"terse": true, "templates": {"fr/OFF.ok": ["Goodnight."]}}`), 0o644)
+	r, err := LoadResponses(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Terse || len(r.templates["fr/OFF.ok"]) != 1 || len(r.templates["ok"]) != 1 {
+		t.Errorf("unexpected responses: %+v", r)
+	}
+
+	for name, body := range map[string]string{
+		"syntax.json":  `{"templates": {"ok": ["{{.Room"]}}`,
+		"field.json":   `{"templates": {"fr/INPUT.ok": ["Enjoy {{.Show}}."]}}`,
+		"empty.json":   `{"templates": {"ok": []}}`,
+		"notjson.json": `templates`,
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(body), 0o644)
+		if _, err := LoadResponses(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestResponses_FallsBackToDefaults(t *testing.T) {
+	r, err := NewResponses(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fails only for some rooms, so it gets past the load-time check.
+	r.templates["INPUT.ok"] = []*template.Template{template.Must(template.New("INPUT.ok").Parse(`{{if eq .Room "Family Room"}}{{.Show}}{{end}}`))}
+	if got := r.Render(FamilyRoom, "INPUT", acknowledged, responseVars{Room: "Family Room", Input: "Netflix"}); got != "<speak>The Family Room is on Netflix.</speak>" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestInputName(t *testing.T) {
+	for key, want := range map[string]string{"NET": "Netflix", "FOUR": "PS4", "WIYOU": "Wii U", "HULU": "hulu"} {
+		if got := inputName(FamilyRoom, key, "hulu"); got != want {
+			t.Errorf("inputName(%s) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -2,30 +2,79 @@ package main
 
 // Room defines the configuration for a room's entertainment system.
 type Room struct {
+	ID             string // short identifier used in skill paths and schedules (e.g., "fr")
 	Name           string
 	TVActionHost   string
 	RokuActionHost string
 	ReceiverHost   string // empty if room has no receiver
 	DefaultVolume  int    // receiver default volume on input switch
 	InputMap       map[string]InputConfig
+	Channels       map[string]ChannelConfig // named channels, keyed like InputMap
+	Capabilities   Capabilities
+}
+
+// Capabilities describes which devices take discrete commands and which only
+// have toggles. Toggles are only sent when the tracked state says they are needed.
+type Capabilities struct {
+	TVDiscretePower bool // TV accepts PowerOn/PowerOff rather than a Power toggle
+	TVDiscreteMute  bool // TV accepts MuteOn/MuteOff rather than a Mute toggle
+	TVRemote        bool // TV accepts navigation and playback keys (Home, Back, Up, …)
+}
+
+// has reports whether the room has the device.
+func (r Room) has(d device) bool {
+	switch d {
+	case deviceTV:
+		return r.TVActionHost != ""
+	case deviceTVRemote:
+		return r.TVActionHost != "" && r.Capabilities.TVRemote
+	case deviceRoku:
+		return r.RokuActionHost != ""
+	case deviceReceiver:
+		return r.ReceiverHost != ""
+	}
+	return false
+}
+
+// devices lists the devices the room has.
+func (r Room) devices() []device {
+	var list []device
+	for _, d := range []device{deviceTV, deviceTVRemote, deviceRoku, deviceReceiver} {
+		if r.has(d) {
+			list = append(list, d)
+		}
+	}
+	return list
 }
 
 // FamilyRoom is the configuration for the family room entertainment system.
 var FamilyRoom = Room{
+	ID:             "fr",
 	Name:           "Family Room",
 	TVActionHost:   "http://192.168.72.20:8080/tv/actions",
 	RokuActionHost: "http://192.168.72.222:8080/systems/family-room/actions",
 	ReceiverHost:   "http://192.168.72.222:8081/receiver/",
 	DefaultVolume:  -30,
 	InputMap:       frInputMap(),
+	Channels:       frChannelMap(),
+	Capabilities:   Capabilities{TVDiscretePower: true},
 }
 
 // MasterBedroom is the configuration for the master bedroom entertainment system.
 var MasterBedroom = Room{
+	ID:             "mbr",
 	Name:           "Master Bedroom",
 	TVActionHost:   "http://192.168.72.25:8080/tv/actions",
 	RokuActionHost: "http://192.168.72.222:8080/systems/master-bedroom/actions",
 	InputMap:       mbInputMap(),
+	Channels:       mbChannelMap(),
+	Capabilities:   Capabilities{TVDiscretePower: true},
+}
+
+// Rooms maps each room ID to its configuration.
+var Rooms = map[string]Room{
+	FamilyRoom.ID:    FamilyRoom,
+	MasterBedroom.ID: MasterBedroom,
 }
 
 func frInputMap() map[string]InputConfig {
@@ -93,3 +142,23 @@ func mbInputMap() map[string]InputConfig {
 
 	return m
 }
+
+// antenna returns a lineup channel received over the TV's antenna input.
+func antenna(number string) ChannelConfig {
+	return ChannelConfig{Number: number, Input: "TV"}
+}
+
+func frChannelMap() map[string]ChannelConfig {
+	m := make(map[string]ChannelConfig)
+	addAliases(m, antenna("4.1"), "CHANNELFOURNEWS", "CHANNEL4NEWS", "FOURNEWS", "NEWSFOUR", "NBC")
+	addAliases(m, antenna("9.2"), "PBSKIDS", "PBSKID")
+	addAliases(m, antenna("32"), "ESPN")
+	return m
+}
+
+func mbChannelMap() map[string]ChannelConfig {
+	m := make(map[string]ChannelConfig)
+	addAliases(m, antenna("4.1"), "CHANNELFOURNEWS", "CHANNEL4NEWS", "FOURNEWS", "NEWSFOUR", "NBC")
+	addAliases(m, antenna("9.2"), "PBSKIDS", "PBSKID")
+	return m
+}
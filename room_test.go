@@ -62,3 +62,19 @@ func TestNoStaleIPAddresses(t *testing.T) {
 		}
 	}
 }
+
+func TestChannelLineups(t *testing.T) {
+	for _, room := range Rooms {
+		for name, ch := range room.Channels {
+			if _, ok := parseChannel(ch.Number); !ok {
+				t.Errorf("%s %s: invalid channel number %q", room.ID, name, ch.Number)
+			}
+			if _, ok := room.InputMap[ch.Input]; ch.Input != "" && !ok {
+				t.Errorf("%s %s: unknown input %q", room.ID, name, ch.Input)
+			}
+		}
+	}
+	if ch := FamilyRoom.Channels["ESPN"]; ch.Input != "TV" {
+		t.Errorf("ESPN = %+v, want the antenna input", ch)
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // distroless images ship without zoneinfo; needed for TZ
+)
+
+// Schedule is a pending power-off for a room. One-shot sleep timers have no Days;
+// recurring schedules fire at Clock on each of Days.
+type Schedule struct {
+	ID     string         `json:"id"`
+	RoomID string         `json:"room"`
+	At     time.Time      `json:"at"`
+	Days   []time.Weekday `json:"days,omitempty"`
+	Clock  string         `json:"clock,omitempty"` // "15:04"
+}
+
+// Recurring reports whether the schedule repeats weekly.
+func (s *Schedule) Recurring() bool {
+	return len(s.Days) > 0
+}
+
+// Scheduler fires room actions at scheduled times and persists pending
+// schedules to a JSON file so they survive restarts.
+type Scheduler struct {
+	mu        sync.Mutex
+	path      string
+	run       func(roomID string)
+	now       func() time.Time
+	schedules map[string]*Schedule
+	timers    map[string]*time.Timer
+	nextID    int
+	stopped   bool
+}
+
+// scheduler is the process-wide scheduler; nil until main initializes it.
+var scheduler *Scheduler
+
+// NewScheduler returns a scheduler that persists to path and calls run when a schedule fires.
+func NewScheduler(path string, run func(roomID string)) *Scheduler {
+	return &Scheduler{
+		path:      path,
+		run:       run,
+		now:       time.Now,
+		schedules: make(map[string]*Schedule),
+		timers:    make(map[string]*time.Timer),
+	}
+}
+
+// expiredTimerGrace is how long past due a sleep timer found on Load may be
+// and still fire. Older ones expired during a long outage, when turning the
+// room off would be a surprise, so they are dropped.
+const expiredTimerGrace = 5 * time.Minute
+
+// Load reads persisted schedules and arms their timers. Sleep timers that
+// expired while the server was down fire immediately if they are within
+// expiredTimerGrace, and are dropped otherwise.
+func (s *Scheduler) Load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var list []*Schedule
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("parse %s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := false
+	for _, sched := range list {
+		if late := s.now().Sub(sched.At); !sched.Recurring() && late > expiredTimerGrace {
+			slog.Warn("dropping expired sleep timer", "schedule_id", sched.ID, "room", sched.RoomID, "at", sched.At, "late", late.Round(time.Second))
+			dropped = true
+			continue
+		}
+		if sched.Recurring() {
+			if err := s.advance(sched); err != nil {
+				slog.Warn("dropping schedule", "schedule_id", sched.ID, "err", err)
+				continue
+			}
+		}
+		s.schedules[sched.ID] = sched
+		if n, err := strconv.Atoi(sched.ID); err == nil && n > s.nextID {
+			s.nextID = n
+		}
+		s.arm(sched)
+	}
+	if dropped {
+		if err := s.save(); err != nil {
+			slog.Error("saving schedules", "err", err)
+		}
+	}
+	return nil
+}
+
+// SetSleepTimer replaces the room's sleep timer with one firing after d.
+func (s *Scheduler) SetSleepTimer(roomID string, d time.Duration) (*Schedule, error) {
+	if d <= 0 {
+		return nil, errors.New("sleep timer duration must be positive")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancel(roomID, false)
+	sched := &Schedule{ID: s.newID(), RoomID: roomID, At: s.now().Add(d)}
+	return sched, s.add(sched)
+}
+
+// AddRecurring schedules a power-off at clock ("15:04") on each of days.
+func (s *Scheduler) AddRecurring(roomID string, days []time.Weekday, clock string) (*Schedule, error) {
+	if len(days) == 0 {
+		return nil, errors.New("recurring schedule needs at least one day")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sched := &Schedule{ID: s.newID(), RoomID: roomID, Days: days, Clock: clock}
+	if err := s.advance(sched); err != nil {
+		return nil, err
+	}
+	return sched, s.add(sched)
+}
+
+// SleepTimer returns the room's pending sleep timer, if any.
+func (s *Scheduler) SleepTimer(roomID string) (*Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sched := range s.schedules {
+		if sched.RoomID == roomID && !sched.Recurring() {
+			return sched, true
+		}
+	}
+	return nil, false
+}
+
+// Remaining returns how long until sched fires.
+func (s *Scheduler) Remaining(sched *Schedule) time.Duration {
+	return sched.At.Sub(s.now())
+}
+
+// Cancel removes the room's sleep timer, or its recurring schedules when
+// recurring is true, and returns how many were removed.
+func (s *Scheduler) Cancel(roomID string, recurring bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.cancel(roomID, recurring)
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.save()
+}
+
+// List returns all pending schedules ordered by fire time.
+func (s *Scheduler) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Schedule, 0, len(s.schedules))
+	for _, sched := range s.schedules {
+		list = append(list, *sched)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].At.Before(list[j].At) })
+	return list
+}
+
+func (s *Scheduler) newID() string {
+	s.nextID++
+	return strconv.Itoa(s.nextID)
+}
+
+// add stores and persists sched, and arms it once it is saved. If saving
+// fails the schedule is dropped, so it never fires unsaved. Callers hold s.mu.
+func (s *Scheduler) add(sched *Schedule) error {
+	s.schedules[sched.ID] = sched
+	if err := s.save(); err != nil {
+		delete(s.schedules, sched.ID)
+		return err
+	}
+	s.arm(sched)
+	return nil
+}
+
+// cancel removes matching schedules without persisting. Callers hold s.mu.
+func (s *Scheduler) cancel(roomID string, recurring bool) int {
+	n := 0
+	for id, sched := range s.schedules {
+		if sched.RoomID != roomID || sched.Recurring() != recurring {
+			continue
+		}
+		if t, ok := s.timers[id]; ok {
+			t.Stop()
+			delete(s.timers, id)
+		}
+		delete(s.schedules, id)
+		n++
+	}
+	return n
+}
+
+// Stop disarms every schedule so none fires during shutdown. They stay
+// saved, and Load arms them again on the next start.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	for id, t := range s.timers {
+		t.Stop()
+		delete(s.timers, id)
+	}
+}
+
+// arm starts the timer for sched, unless the scheduler is stopped. Callers
+// hold s.mu.
+func (s *Scheduler) arm(sched *Schedule) {
+	if s.stopped {
+		return
+	}
+	d := sched.At.Sub(s.now())
+	if d < 0 {
+		d = 0
+	}
+	id := sched.ID
+	s.timers[id] = time.AfterFunc(d, func() { s.fire(id) })
+}
+
+func (s *Scheduler) fire(id string) {
+	s.mu.Lock()
+	sched, ok := s.schedules[id]
+	if !ok || s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.timers, id)
+	roomID := sched.RoomID
+	if sched.Recurring() {
+		if err := s.advance(sched); err != nil {
+			slog.Warn("dropping schedule", "schedule_id", id, "err", err)
+			delete(s.schedules, id)
+		} else {
+			s.arm(sched)
+		}
+	} else {
+		delete(s.schedules, id)
+	}
+	if err := s.save(); err != nil {
+		slog.Error("saving schedules", "err", err)
+	}
+	s.mu.Unlock()
+
+	slog.Info("schedule firing", "schedule_id", id, "room", roomID)
+	s.run(roomID)
+}
+
+// advance sets sched.At to the next occurrence of a recurring schedule.
+func (s *Scheduler) advance(sched *Schedule) error {
+	hour, minute, err := parseClock(sched.Clock)
+	if err != nil {
+		return err
+	}
+	sched.At = nextOccurrence(s.now(), sched.Days, hour, minute)
+	return nil
+}
+
+// save writes all schedules to disk atomically. Callers hold s.mu.
+func (s *Scheduler) save() error {
+	list := make([]*Schedule, 0, len(s.schedules))
+	for _, sched := range s.schedules {
+		list = append(list, sched)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".schedules-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// nextOccurrence returns the first time strictly after now that falls on one
+// of days at hour:minute in now's location.
+func nextOccurrence(now time.Time, days []time.Weekday, hour, minute int) time.Time {
+	for i := 0; i <= 7; i++ {
+		d := now.AddDate(0, 0, i)
+		t := time.Date(d.Year(), d.Month(), d.Day(), hour, minute, 0, 0, now.Location())
+		if !t.After(now) {
+			continue
+		}
+		for _, wd := range days {
+			if t.Weekday() == wd {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// parseClock parses an AMAZON.TIME value such as "23:00". The fuzzy values
+// Alexa uses for "tonight" and friends are mapped to fixed times.
+func parseClock(v string) (hour, minute int, err error) {
+	switch strings.ToUpper(v) {
+	case "MO":
+		return 9, 0, nil
+	case "AF":
+		return 14, 0, nil
+	case "EV":
+		return 19, 0, nil
+	case "NI":
+		return 22, 0, nil
+	}
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time %q", v)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseISODuration parses the ISO-8601 durations sent in AMAZON.DURATION
+// slots, such as "PT30M" or "PT1H30M".
+func parseISODuration(v string) (time.Duration, error) {
+	m := isoDuration.FindStringSubmatch(strings.ToUpper(v))
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	matched := false
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		n, _ := strconv.Atoi(m[i+1])
+		d += time.Duration(n) * unit
+		matched = true
+	}
+	if !matched {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	return d, nil
+}
+
+var (
+	weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	weekends = []time.Weekday{time.Saturday, time.Sunday}
+	allDays  = []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}
+	// weeknights are school nights: the evenings before a weekday.
+	weeknights = []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday}
+)
+
+// parseDays maps a spoken Days slot ("weeknights", "every day", "friday") to weekdays.
+func parseDays(v string) ([]time.Weekday, error) {
+	key := strings.ReplaceAll(strings.ToUpper(v), " ", "")
+	key = strings.TrimPrefix(key, "EVERY")
+	key = strings.TrimSuffix(key, "S")
+	switch key {
+	case "WEEKDAY":
+		return weekdays, nil
+	case "WEEKNIGHT", "SCHOOLNIGHT":
+		return weeknights, nil
+	case "WEEKEND":
+		return weekends, nil
+	case "DAY", "NIGHT", "DAILY", "NIGHTLY", "":
+		return allDays, nil
+	}
+	for _, wd := range allDays {
+		if strings.ToUpper(wd.String()) == key {
+			return []time.Weekday{wd}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown days %q", v)
+}
+
+// describeDays renders days for speech, e.g. "on weeknights" or "on Friday".
+func describeDays(days []time.Weekday) string {
+	switch {
+	case sameDays(days, allDays):
+		return "every day"
+	case sameDays(days, weekdays):
+		return "on weekdays"
+	case sameDays(days, weeknights):
+		return "on weeknights"
+	case sameDays(days, weekends):
+		return "on weekends"
+	}
+	names := make([]string, len(days))
+	for i, wd := range days {
+		names[i] = wd.String()
+	}
+	return "on " + strings.Join(names, ", ")
+}
+
+func sameDays(a, b []time.Weekday) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// formatDuration renders d for speech, e.g. "1 hour and 5 minutes".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		return "less than a minute"
+	}
+	hours := int(d / time.Hour)
+	minutes := int((d % time.Hour) / time.Minute)
+	var parts []string
+	if hours > 0 {
+		parts = append(parts, plural(hours, "hour"))
+	}
+	if minutes > 0 {
+		parts = append(parts, plural(minutes, "minute"))
+	}
+	return strings.Join(parts, " and ")
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return strconv.Itoa(n) + " " + unit + "s"
+}
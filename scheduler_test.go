@@ -0,0 +1,282 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"PT30M", 30 * time.Minute},
+		{"PT1H30M", 90 * time.Minute},
+		{"PT2H", 2 * time.Hour},
+		{"PT45S", 45 * time.Second},
+		{"P1D", 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		got, err := parseISODuration(tt.in)
+		if err != nil {
+			t.Errorf("parseISODuration(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseISODuration(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "P", "PT", "30 minutes", "PT1X"} {
+		if _, err := parseISODuration(bad); err == nil {
+			t.Errorf("parseISODuration(%q): expected error", bad)
+		}
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []time.Weekday
+	}{
+		{"weeknights", weeknights},
+		{"every weeknight", weeknights},
+		{"weekdays", weekdays},
+		{"weekends", weekends},
+		{"every day", allDays},
+		{"", allDays},
+		{"friday", []time.Weekday{time.Friday}},
+	}
+	for _, tt := range tests {
+		got, err := parseDays(tt.in)
+		if err != nil {
+			t.Errorf("parseDays(%q): %v", tt.in, err)
+			continue
+		}
+		if !sameDays(got, tt.want) {
+			t.Errorf("parseDays(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := parseDays("someday"); err == nil {
+		t.Error("expected error for unknown days")
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	// Wednesday 2026-10-21 22:00 UTC
+	now := time.Date(2026, 10, 21, 22, 0, 0, 0, time.UTC)
+
+	got := nextOccurrence(now, weeknights, 23, 0)
+	want := time.Date(2026, 10, 21, 23, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("same-day: got %v, want %v", got, want)
+	}
+
+	// Thursday night is a weeknight, Friday and Saturday are not.
+	got = nextOccurrence(now.Add(2*time.Hour), weeknights, 23, 0)
+	want = time.Date(2026, 10, 22, 23, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("next-day: got %v, want %v", got, want)
+	}
+
+	got = nextOccurrence(time.Date(2026, 10, 23, 0, 0, 0, 0, time.UTC), weeknights, 23, 0)
+	want = time.Date(2026, 10, 25, 23, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("over weekend: got %v, want %v", got, want)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{30 * time.Minute, "30 minutes"},
+		{time.Hour, "1 hour"},
+		{65 * time.Minute, "1 hour and 5 minutes"},
+		{10 * time.Second, "less than a minute"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.in); got != tt.want {
+			t.Errorf("formatDuration(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestScheduler_SleepTimerFires(t *testing.T) {
+	fired := make(chan string, 1)
+	s := NewScheduler(filepath.Join(t.TempDir(), "schedules.json"), func(roomID string) {
+		fired <- roomID
+	})
+
+	if _, err := s.SetSleepTimer("mbr", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case roomID := <-fired:
+		if roomID != "mbr" {
+			t.Errorf("expected mbr, got %s", roomID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("sleep timer did not fire")
+	}
+
+	if _, ok := s.SleepTimer("mbr"); ok {
+		t.Error("expected sleep timer to be removed after firing")
+	}
+}
+
+func TestScheduler_SleepTimerNotArmedWhenSaveFails(t *testing.T) {
+	fired := make(chan string, 1)
+	s := NewScheduler(filepath.Join(t.TempDir(), "missing", "schedules.json"), func(roomID string) {
+		fired <- roomID
+	})
+
+	if _, err := s.SetSleepTimer("mbr", 10*time.Millisecond); err == nil {
+		t.Fatal("expected an error saving to a missing directory")
+	}
+	if _, ok := s.SleepTimer("mbr"); ok {
+		t.Error("expected no sleep timer after a failed save")
+	}
+	select {
+	case <-fired:
+		t.Fatal("unsaved sleep timer fired")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestScheduler_StopDisarms(t *testing.T) {
+	fired := make(chan string, 2)
+	s := NewScheduler(filepath.Join(t.TempDir(), "schedules.json"), func(roomID string) {
+		fired <- roomID
+	})
+
+	if _, err := s.SetSleepTimer("mbr", 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	s.Stop()
+	if _, err := s.SetSleepTimer("fr", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case roomID := <-fired:
+		t.Fatalf("schedule for %s fired after Stop", roomID)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, ok := s.SleepTimer("mbr"); !ok {
+		t.Error("expected stopped schedules to stay saved")
+	}
+}
+
+func TestScheduler_SleepTimerReplacesAndCancels(t *testing.T) {
+	s := NewScheduler(filepath.Join(t.TempDir(), "schedules.json"), func(string) {})
+
+	s.SetSleepTimer("fr", time.Hour)
+	s.SetSleepTimer("fr", 30*time.Minute)
+
+	sched, ok := s.SleepTimer("fr")
+	if !ok {
+		t.Fatal("expected sleep timer")
+	}
+	if r := s.Remaining(sched); r > 30*time.Minute {
+		t.Errorf("expected replacement timer, remaining %v", r)
+	}
+	if len(s.List()) != 1 {
+		t.Errorf("expected 1 schedule, got %d", len(s.List()))
+	}
+
+	n, err := s.Cancel("fr", false)
+	if err != nil || n != 1 {
+		t.Errorf("Cancel = %d, %v", n, err)
+	}
+	if _, ok := s.SleepTimer("fr"); ok {
+		t.Error("expected sleep timer to be cancelled")
+	}
+}
+
+func TestScheduler_PersistsAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+
+	s := NewScheduler(path, func(string) {})
+	if _, err := s.SetSleepTimer("mbr", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddRecurring("fr", weeknights, "23:00"); err != nil {
+		t.Fatal(err)
+	}
+	s.Cancel("mbr", false)
+	s.SetSleepTimer("mbr", time.Hour)
+
+	reloaded := NewScheduler(path, func(string) {})
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	list := reloaded.List()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 schedules after reload, got %d", len(list))
+	}
+	if _, ok := reloaded.SleepTimer("mbr"); !ok {
+		t.Error("expected mbr sleep timer after reload")
+	}
+
+	// New IDs must not collide with reloaded ones.
+	sched, _ := reloaded.AddRecurring("mbr", weekends, "01:00")
+	for _, existing := range list {
+		if existing.ID == sched.ID {
+			t.Errorf("reused schedule ID %s", sched.ID)
+		}
+	}
+}
+
+func TestScheduler_ExpiredTimerFiresOnLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+
+	s := NewScheduler(path, func(string) {})
+	s.now = func() time.Time { return time.Now().Add(-time.Hour - time.Minute) }
+	s.SetSleepTimer("mbr", time.Hour)
+
+	fired := make(chan string, 1)
+	reloaded := NewScheduler(path, func(roomID string) { fired <- roomID })
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("expired sleep timer did not fire on load")
+	}
+}
+
+func TestScheduler_StaleTimerDroppedOnLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+
+	s := NewScheduler(path, func(string) {})
+	s.now = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+	s.SetSleepTimer("mbr", time.Hour)
+
+	fired := make(chan string, 1)
+	reloaded := NewScheduler(path, func(roomID string) { fired <- roomID })
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-fired:
+		t.Fatal("sleep timer an hour past due fired on load")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if list := reloaded.List(); len(list) != 0 {
+		t.Errorf("expected stale timer dropped, got %+v", list)
+	}
+	again := NewScheduler(path, func(string) {})
+	if err := again.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if list := again.List(); len(list) != 0 {
+		t.Errorf("expected stale timer removed from file, got %+v", list)
+	}
+}
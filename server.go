@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"syscall"
+	"time"
+)
+
+// Server limits. Alexa gives a skill 8 seconds to answer, and its requests
+// are a few kilobytes.
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 10 * time.Second
+	writeTimeout      = 15 * time.Second
+	idleTimeout       = 60 * time.Second
+	maxBodyBytes      = 256 << 10
+)
+
+// traceFlushTimeout bounds exporting the last spans on shutdown.
+const traceFlushTimeout = 5 * time.Second
+
+// newServer returns a server for handler with the standard timeouts and
+// middleware.
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           withMiddleware(handler),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+// newRouter mounts each skill at its path with the liveness route
+// alongside. Routes for the main port are registered here; /metrics and
+// /readyz describe the home network, so they are on the admin API instead.
+func newRouter(frontends ...Frontend) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, f := range frontends {
+		for pattern, h := range f.Routes() {
+			mux.Handle(pattern, h)
+		}
+	}
+	mux.HandleFunc("GET /healthz", healthzHandler)
+	return mux
+}
+
+// withMiddleware recovers from panics, limits request bodies and logs each
+// request at debug level.
+func withMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				slog.Error("panic serving request", "method", r.Method, "path", r.URL.Path, "panic", p, "stack", string(debug.Stack()))
+				if !rec.wrote {
+					http.Error(rec, "Internal Server Error", http.StatusInternalServerError)
+				}
+			}
+			slog.Debug("request", "method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", time.Since(start))
+		}()
+		r.Body = http.MaxBytesReader(rec, r.Body, maxBodyBytes)
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// statusRecorder remembers the status written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wrote {
+		r.status, r.wrote = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wrote = true
+	return r.ResponseWriter.Write(b)
+}
+
+// serve runs the servers until SIGTERM or SIGINT, then stops accepting
+// requests, finishes the in-flight ones, calls stop to halt anything else
+// that starts device calls, and waits up to timeout for background device
+// calls before returning.
+func serve(timeout time.Duration, stop func(), servers ...*http.Server) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			slog.Info("listening", "addr", srv.Addr, "tls", srv.TLSConfig != nil)
+			var err error
+			if srv.TLSConfig != nil {
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				errs <- err
+			}
+		}(srv)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down", "timeout", timeout)
+	case err = <-errs:
+		slog.Error("server failed, shutting down", "err", err)
+	}
+	if e := shutdown(timeout, stop, servers...); err == nil {
+		err = e
+	}
+	return err
+}
+
+// shutdown gracefully stops the servers and calls stop, then drains
+// background device calls, refusing new ones, all within timeout.
+func shutdown(timeout time.Duration, stop func(), servers ...*http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var err error
+	for _, srv := range servers {
+		if e := srv.Shutdown(ctx); e != nil {
+			slog.Error("stopping server", "addr", srv.Addr, "err", e)
+			err = e
+		}
+	}
+	stop()
+	pending.Close()
+	if !drainPending(ctx) {
+		err = errors.New("abandoned device calls")
+	}
+	// Captures are written once their device calls finish, so close the log
+	// only after draining.
+	if captureLog != nil {
+		if e := captureLog.Close(); e != nil {
+			slog.Error("closing capture log", "err", e)
+			err = e
+		}
+	}
+	if tracer != nil {
+		// Flush the spans of the drained calls, even if draining used up
+		// the shutdown timeout.
+		flushCtx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+		defer cancel()
+		tracer.Shutdown(flushCtx)
+	}
+	return err
+}
+
+// drainPending waits for background device calls until ctx is done, logging
+// every call still in flight if it gives up. It reports whether all
+// finished.
+func drainPending(ctx context.Context) bool {
+	select {
+	case <-pending.Idle():
+		return true
+	case <-ctx.Done():
+	}
+	for _, c := range inflight.List() {
+		slog.Error("abandoned device call", "method", c.Method, "url", c.URL, "body", c.Body, "started", c.Time)
+	}
+	return false
+}
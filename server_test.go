@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+func TestRouter_RoomSkill(t *testing.T) {
+	room := testRoom("", "", "")
+	handler := newRouter(alexaSkills{"/echo/test": roomSkill("amzn1.ask.skill.test", room)})
+
+	req := newEchoRequest("STATUS", nil)
+	req.Session.Application.ApplicationID = "amzn1.ask.skill.test"
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/echo/test?_dev=1", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp alexa.ResponseEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resp.Speech(), "<speak>I don't know what's on in the Test Room yet.</speak>"; got != want {
+		t.Errorf("speech = %q, want %q", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/echo/test", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d", rec.Code)
+	}
+}
+
+func TestDrainPending(t *testing.T) {
+	release := make(chan struct{})
+	tv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer tv.Close()
+
+	goAction(context.Background(), tv.URL, "PowerOff", "")
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if drainPending(ctx) {
+		t.Fatal("expected drain to give up on a blocked call")
+	}
+	calls := inflight.List()
+	if len(calls) != 1 || calls[0].URL != tv.URL {
+		t.Errorf("in flight = %+v", calls)
+	}
+
+	close(release)
+	if !drainPending(context.Background()) {
+		t.Error("expected drain to finish once the call returns")
+	}
+	if calls := inflight.List(); len(calls) != 0 {
+		t.Errorf("in flight after drain = %+v", calls)
+	}
+}
+
+func TestCallGroup_RefusesWorkOnceClosed(t *testing.T) {
+	g := newCallGroup()
+	select {
+	case <-g.Idle():
+	default:
+		t.Fatal("expected a new group to be idle")
+	}
+
+	if !g.add() {
+		t.Fatal("expected an open group to accept work")
+	}
+	idle := g.Idle()
+	g.Close()
+	if g.add() {
+		t.Error("expected a closed group to refuse work")
+	}
+	select {
+	case <-idle:
+		t.Fatal("group idle while work is running")
+	default:
+	}
+	g.done()
+	select {
+	case <-idle:
+	case <-time.After(time.Second):
+		t.Fatal("group not idle after its work finished")
+	}
+}
+
+func TestServe_StopsBeforeDraining(t *testing.T) {
+	saved := pending
+	pending = newCallGroup()
+	defer func() { pending = saved }()
+
+	// A failing listener shuts serve down without a signal. stop starts a
+	// device call the way a firing schedule would; the drain must wait for
+	// it rather than the closed group dropping it.
+	var finished atomic.Bool
+	stopped := false
+	stop := func() {
+		stopped = true
+		background(context.Background(), func() {
+			time.Sleep(50 * time.Millisecond)
+			finished.Store(true)
+		})
+	}
+	if err := serve(time.Second, stop, newServer("127.0.0.1:-1", newRouter())); err == nil {
+		t.Error("expected the listen error")
+	}
+	if !stopped {
+		t.Fatal("serve did not call stop")
+	}
+	if !finished.Load() {
+		t.Error("the call stop started was not drained")
+	}
+}
+
+func TestMiddleware_RecoversPanics(t *testing.T) {
+	handler := withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+}
+
+func TestMiddleware_LimitsBody(t *testing.T) {
+	server := httptest.NewServer(newServer("", newRouter(alexaSkills{
+		"/echo/test": alexa.NewSkill("amzn1.ask.skill.test"),
+	})).Handler)
+	defer server.Close()
+
+	body := `{"version": "` + strings.Repeat("x", maxBodyBytes) + `"}`
+	resp, err := http.Post(server.URL+"/echo/test?_dev=1", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", resp.StatusCode)
+	}
+}
+
+func TestNewServer_Routes(t *testing.T) {
+	srv := newServer(":0", newRouter())
+	if srv.ReadHeaderTimeout == 0 || srv.ReadTimeout == 0 || srv.WriteTimeout == 0 || srv.IdleTimeout == 0 {
+		t.Errorf("missing timeouts: %+v", srv)
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/healthz", http.StatusOK},
+		{"POST", "/healthz", http.StatusMethodNotAllowed},
+		{"GET", "/metrics", http.StatusNotFound},
+		{"GET", "/readyz", http.StatusNotFound},
+		{"GET", "/nope", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// slotFlags collects repeated --slot Name=value flags.
+type slotFlags map[string]string
+
+func (s slotFlags) String() string {
+	pairs := make([]string, 0, len(s))
+	for name, value := range s {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (s slotFlags) Set(v string) error {
+	name, value, ok := strings.Cut(v, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("slot must be Name=value, got %q", v)
+	}
+	s[name] = value
+	return nil
+}
+
+// simulate runs one intent through a room's handler as if Alexa had sent it,
+// printing the request, the speech response and the device calls made. It
+// returns the process exit code.
+func simulate(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fs.SetOutput(out)
+	roomID := fs.String("room", "", "room ID (e.g. fr, mbr)")
+	intent := fs.String("intent", "", "intent name (e.g. INPUT)")
+	dry := fs.Bool("dry-run", dryRunFromEnv(), "record device calls without sending them (default from DRY_RUN)")
+	slots := slotFlags{}
+	fs.Var(slots, "slot", "slot as Name=value; repeatable")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	room, ok := Rooms[*roomID]
+	if !ok || *intent == "" {
+		fmt.Fprintln(out, "usage: go-alexa-api simulate --room ID --intent NAME [--slot Name=value]... [--dry-run]")
+		return 2
+	}
+
+	echoReq := newIntentRequest(*intent, slots)
+	echoReq.Request.RequestID = fmt.Sprintf("simulate.%d", time.Now().UnixNano())
+	echoReq.Request.Timestamp = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	reqJSON, _ := json.MarshalIndent(echoReq, "", "  ")
+	fmt.Fprintf(out, "Request:\n%s\n\n", reqJSON)
+
+	ctx := context.Background()
+	if *dry {
+		ctx = withDryRun(ctx, NewCallLog(dryRunLimit))
+	}
+	ctx, rc := withRequestCalls(ctx)
+	resp := serveIntent(ctx, room, alexaIntentRequest(echoReq))
+	calls := rc.Wait()
+
+	fmt.Fprintf(out, "Speech: %s\n\n", resp.Text())
+
+	verb := "Device calls"
+	if *dry {
+		verb = "Device calls (dry run, not sent)"
+	}
+	fmt.Fprintf(out, "%s:\n", verb)
+	if len(calls) == 0 {
+		fmt.Fprintln(out, "  (none)")
+	}
+	for _, c := range calls {
+		fmt.Fprintf(out, "  %s %s %s\n", c.Method, c.URL, c.Body)
+	}
+	return 0
+}
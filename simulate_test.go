@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSimulate_DryRun(t *testing.T) {
+	resetState()
+	var out bytes.Buffer
+	code := simulate([]string{"--room", "fr", "--intent", "INPUT", "--slot", "InputType=netflix", "--dry-run"}, &out)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, out.String())
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		`"name": "INPUT"`,
+		`"value": "netflix"`,
+		"Speech: The Family Room is on Netflix.",
+		"(dry run, not sent)",
+		`PUT ` + FamilyRoom.ReceiverHost + ` {"input":"HDMI1","on":true,"volume":-30}`,
+		`POST ` + FamilyRoom.RokuActionHost + ` {"command":"input","value":"Netflix"}`,
+		`POST ` + FamilyRoom.TVActionHost + ` {"command":"PowerOn"}`,
+		`POST ` + FamilyRoom.TVActionHost + ` {"command":"HDMI1"}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	if dryRun.Load() {
+		t.Error("simulate left dry-run mode on")
+	}
+}
+
+func TestSimulate_Executes(t *testing.T) {
+	tv := &deviceRecorder{}
+	server := httptest.NewServer(tv)
+	defer server.Close()
+
+	room := testRoom(server.URL, "", "")
+	addRoom(t, room)
+
+	var out bytes.Buffer
+	if code := simulate([]string{"--room", "test", "--intent", "channel", "--slot", "Number=5"}, &out); code != 0 {
+		t.Fatalf("exit code %d: %s", code, out.String())
+	}
+
+	if calls := tv.Calls(); len(calls) != 1 || calls[0] != `{"command":"Channel","value":"5"}` {
+		t.Errorf("unexpected TV calls: %v", calls)
+	}
+	if !strings.Contains(out.String(), "POST "+server.URL+` {"command":"Channel","value":"5"}`) {
+		t.Errorf("output missing device call:\n%s", out.String())
+	}
+}
+
+func TestSimulate_DryRunFromEnv(t *testing.T) {
+	tv := &deviceRecorder{}
+	server := httptest.NewServer(tv)
+	defer server.Close()
+
+	room := testRoom(server.URL, "", "")
+	addRoom(t, room)
+	t.Setenv("DRY_RUN", "true")
+
+	var out bytes.Buffer
+	if code := simulate([]string{"--room", "test", "--intent", "channel", "--slot", "Number=5"}, &out); code != 0 {
+		t.Fatalf("exit code %d: %s", code, out.String())
+	}
+	if calls := tv.Calls(); len(calls) != 0 {
+		t.Errorf("DRY_RUN=true sent TV calls: %v", calls)
+	}
+	if !strings.Contains(out.String(), "(dry run, not sent)") {
+		t.Errorf("output not marked as a dry run:\n%s", out.String())
+	}
+
+	out.Reset()
+	if code := simulate([]string{"--room", "test", "--intent", "channel", "--slot", "Number=6", "--dry-run=false"}, &out); code != 0 {
+		t.Fatalf("exit code %d: %s", code, out.String())
+	}
+	if calls := tv.Calls(); len(calls) != 1 {
+		t.Errorf("--dry-run=false should send, got TV calls %v", calls)
+	}
+}
+
+func TestSimulate_Usage(t *testing.T) {
+	var out bytes.Buffer
+	if code := simulate([]string{"--room", "garage", "--intent", "OFF"}, &out); code != 2 {
+		t.Errorf("expected exit code 2 for unknown room, got %d", code)
+	}
+	if code := simulate([]string{"--room", "fr", "--slot", "novalue"}, &out); code != 2 {
+		t.Errorf("expected exit code 2 for bad slot, got %d", code)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// slotType is how a slot's value is parsed before its intent runs.
+type slotType int
+
+const (
+	slotText    slotType = iota // any value, as said
+	slotNumber                  // a whole number between Min and Max
+	slotChannel                 // a channel number, with an optional subchannel
+)
+
+// slotSpec declares one of an intent's slots.
+type slotSpec struct {
+	Name     string
+	Type     slotType
+	Required bool
+	Noun     string // what the value is, for prompts ("volume level")
+	Min, Max int    // bounds of a slotNumber
+}
+
+// parse converts a value to the form handlers use: digits for numbers, and
+// for channels a key of the room's lineup or "5" or "5.1". It reports false
+// if the value isn't valid.
+func (s slotSpec) parse(room Room, value string) (string, bool) {
+	switch s.Type {
+	case slotNumber:
+		n, ok := parseNumber(value)
+		if !ok || n < s.Min || n > s.Max {
+			return "", false
+		}
+		return strconv.Itoa(n), true
+	case slotChannel:
+		if _, ok := room.Channels[aliasKey(value)]; ok {
+			return aliasKey(value), true
+		}
+		return parseChannel(value)
+	}
+	return value, true
+}
+
+// hint tells the user what the slot takes in room, or is "" for text
+// slots.
+func (s slotSpec) hint(room Room) string {
+	switch s.Type {
+	case slotNumber:
+		return fmt.Sprintf("Say a %s from %d to %d.", s.Noun, s.Min, s.Max)
+	case slotChannel:
+		if len(room.Channels) > 0 {
+			return "Say a channel number, like 5 or 5.1, or a channel name."
+		}
+		return "Say a channel number, like 5 or 5.1."
+	}
+	return ""
+}
+
+var (
+	numberWords = map[string]int{
+		"zero": 0, "oh": 0, "a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4,
+		"five": 5, "six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+		"eleven": 11, "twelve": 12, "thirteen": 13, "fourteen": 14, "fifteen": 15,
+		"sixteen": 16, "seventeen": 17, "eighteen": 18, "nineteen": 19,
+		"twenty": 20, "thirty": 30, "forty": 40, "fifty": 50,
+		"sixty": 60, "seventy": 70, "eighty": 80, "ninety": 90,
+	}
+	// numberPhrases are vague amounts Alexa passes through as said.
+	numberPhrases = map[string]int{"a couple": 2, "a couple of": 2, "a few": 3}
+	// digitRange matches "2-3"; a hyphen between words is part of the
+	// number, as in "twenty-five".
+	digitRange = regexp.MustCompile(`^\d+\s*-\s*\d+$`)
+)
+
+// parseNumber converts digits or spoken English ("twenty five", "a
+// hundred") to a whole number. For a range such as "two or three" it
+// returns the lower end, the cautious choice for volume and movement.
+func parseNumber(s string) (int, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if n, ok := numberPhrases[s]; ok {
+		return n, true
+	}
+	seps := []string{" to ", " or ", " through "}
+	if digitRange.MatchString(s) {
+		seps = []string{"-"}
+	}
+	for _, sep := range seps {
+		if a, b, ok := strings.Cut(s, sep); ok {
+			lo, okA := parseNumber(a)
+			hi, okB := parseNumber(b)
+			if !okA || !okB {
+				return 0, false
+			}
+			return min(lo, hi), true
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, n >= 0
+	}
+	return parseNumberWords(s)
+}
+
+// parseNumberWords converts spoken English below a million to a number.
+func parseNumberWords(s string) (int, bool) {
+	words := strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == '-' })
+	if len(words) == 0 {
+		return 0, false
+	}
+	total, current, seen := 0, 0, false
+	for _, w := range words {
+		switch w {
+		case "and":
+			continue
+		case "hundred":
+			if current == 0 {
+				current = 1
+			}
+			current *= 100
+		case "thousand":
+			if current == 0 {
+				current = 1
+			}
+			total += current * 1000
+			current = 0
+		default:
+			n, ok := numberWords[w]
+			if !ok {
+				return 0, false
+			}
+			current += n
+		}
+		seen = true
+	}
+	return total + current, seen
+}
+
+// channelNumber matches digital channels written as Alexa transcribes them:
+// "5", "5.1" or "5-1".
+var channelNumber = regexp.MustCompile(`^(\d{1,4})(?:\s*[.\-]\s*(\d{1,2}))?$`)
+
+// parseChannel converts a channel to "5" or, for a digital subchannel,
+// "5.1". Spoken forms such as "five point one" and "five dash one" are
+// accepted too.
+func parseChannel(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if m := channelNumber.FindStringSubmatch(s); m != nil {
+		major, _ := strconv.Atoi(m[1])
+		if major == 0 {
+			return "", false
+		}
+		if m[2] == "" {
+			return strconv.Itoa(major), true
+		}
+		minor, _ := strconv.Atoi(m[2])
+		if minor == 0 {
+			return "", false
+		}
+		return fmt.Sprintf("%d.%d", major, minor), true
+	}
+	for _, sep := range []string{" point ", " dot ", " dash "} {
+		if a, b, ok := strings.Cut(s, sep); ok {
+			major, okA := parseNumber(a)
+			minor, okB := parseNumber(b)
+			if !okA || !okB || major == 0 || minor == 0 || minor > 99 {
+				return "", false
+			}
+			return fmt.Sprintf("%d.%d", major, minor), true
+		}
+	}
+	if digits, ok := spokenDigits(s); ok {
+		s = digits
+	} else if n, ok := parseNumberWords(s); ok {
+		s = strconv.Itoa(n)
+	} else {
+		return "", false
+	}
+	n, _ := strconv.Atoi(s)
+	if n == 0 || n > 9999 {
+		return "", false
+	}
+	return strconv.Itoa(n), true
+}
+
+// spokenDigits reads channels said digit by digit, such as "one oh seven".
+func spokenDigits(s string) (string, bool) {
+	words := strings.Fields(s)
+	if len(words) < 2 {
+		return "", false
+	}
+	var b strings.Builder
+	for _, w := range words {
+		n, ok := numberWords[w]
+		if !ok || n > 9 || w == "a" || w == "an" {
+			return "", false
+		}
+		b.WriteString(strconv.Itoa(n))
+	}
+	return b.String(), true
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestParseNumber(t *testing.T) {
+	tests := map[string]int{
+		"30": 30, "twenty five": 25, "twenty-five": 25, "Forty": 40, "a hundred": 100,
+		"one hundred and five": 105, "two thousand": 2000, "a couple": 2, "a few": 3,
+		"two or three": 2, "20 to 30": 20, "5-3": 3, "ten through twelve": 10,
+	}
+	for in, want := range tests {
+		if got, ok := parseNumber(in); !ok || got != want {
+			t.Errorf("parseNumber(%q) = %d, %v; want %d", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"", "?", "loud", "a lot", "-3", "and", "five or loud"} {
+		if got, ok := parseNumber(in); ok {
+			t.Errorf("parseNumber(%q) = %d, want invalid", in, got)
+		}
+	}
+}
+
+func TestParseChannel(t *testing.T) {
+	tests := map[string]string{
+		"5": "5", "05": "5", "5.1": "5.1", "5-1": "5.1", "13 . 2": "13.2",
+		"five": "5", "five point one": "5.1", "forty four dash three": "44.3", "one oh seven": "107", "twenty two": "22",
+	}
+	for in, want := range tests {
+		if got, ok := parseChannel(in); !ok || got != want {
+			t.Errorf("parseChannel(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"", "0", "5.0", "5.1.2", "ESPN", "5 point 100"} {
+		if got, ok := parseChannel(in); ok {
+			t.Errorf("parseChannel(%q) = %q, want invalid", in, got)
+		}
+	}
+}
+
+func TestSlotSpec_Parse(t *testing.T) {
+	for in, want := range map[string]string{"3": "3", "twenty": "20", "a couple": "2", "0": "", "21": "", "a lot": ""} {
+		got, ok := spacesSlot[0].parse(Room{}, in)
+		if ok != (want != "") || got != want {
+			t.Errorf("Spaces %q = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	if got := spacesSlot[0].hint(Room{}); got != "Say a number of spaces from 1 to 20." {
+		t.Errorf("hint = %q", got)
+	}
+}
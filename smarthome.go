@@ -0,0 +1,318 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+// smartHomeInputs maps Alexa's standard input names, with spaces removed,
+// to InputMap keys where they differ.
+var smartHomeInputs = map[string]string{
+	"PLAYSTATION2": "PS2",
+	"PLAYSTATION3": "PS3",
+	"PLAYSTATION4": "PS4",
+	"PLAYSTATION5": "PS5",
+}
+
+// playbackIntents maps PlaybackController operations to intents.
+var playbackIntents = map[string]string{
+	"Play":        "PLAY",
+	"FastForward": "FORWARD",
+	"Rewind":      "REVERSE",
+}
+
+// smartHomeFrontend serves Smart Home directives forwarded by a Lambda
+// proxy that authenticates with token.
+type smartHomeFrontend struct {
+	token string
+}
+
+func (f smartHomeFrontend) Routes() map[string]http.Handler {
+	return map[string]http.Handler{"POST /smarthome": requireToken(f.token, alexa.SmartHomeFunc(handleSmartHome))}
+}
+
+// settleTimeout is how long a Smart Home response waits for the request's
+// device calls, so it reports the state they leave and any failure.
+const settleTimeout = 2 * time.Second
+
+// errUnsupportedDirective is returned for directives rooms don't handle.
+var errUnsupportedDirective = errors.New("unsupported directive")
+
+// smartHomeCommand is the intent a Smart Home directive stands for.
+type smartHomeCommand struct {
+	Intent string
+	Slots  map[string]string
+	// Already reports whether a room is in the state the directive asks
+	// for, so a command that needed no device call isn't taken for one
+	// that never reached the devices. Nil for directives that always send.
+	Already func(st RoomState) bool
+}
+
+// maxSkipChannels bounds SkipChannels, which sends one command per channel.
+const maxSkipChannels = 99
+
+// smartHomePayload is the union of the directive payloads rooms handle.
+type smartHomePayload struct {
+	Input         string `json:"input"`
+	Volume        *int   `json:"volume"`
+	VolumeDefault bool   `json:"volumeDefault"`
+	Mute          *bool  `json:"mute"`
+	Channel       struct {
+		Number            string `json:"number"`
+		CallSign          string `json:"callSign"`
+		AffiliateCallSign string `json:"affiliateCallSign"`
+	} `json:"channel"`
+	ChannelMetadata struct {
+		Name string `json:"name"`
+	} `json:"channelMetadata"`
+	ChannelCount int `json:"channelCount"`
+}
+
+// handleSmartHome answers a Smart Home directive. Each room is one TV
+// endpoint whose ID is the room ID, and directives run as the matching
+// intent through serveIntent, as if spoken to the room's custom skill.
+func handleSmartHome(ctx context.Context, d *alexa.Directive) *alexa.SmartHomeResponse {
+	if d.Header.Namespace == "Alexa.Discovery" && d.Header.Name == "Discover" {
+		return d.Response("Alexa.Discovery", "Discover.Response", map[string]any{"endpoints": discoveryEndpoints()})
+	}
+	if d.Endpoint == nil {
+		return d.ErrorResponse(alexa.ErrorInvalidDirective, "directive has no endpoint")
+	}
+	room, ok := Rooms[d.Endpoint.EndpointID]
+	if !ok {
+		return d.ErrorResponse(alexa.ErrorNoSuchEndpoint, "no room "+d.Endpoint.EndpointID)
+	}
+	if d.Header.Namespace == "Alexa" && d.Header.Name == "ReportState" {
+		resp := d.Response("Alexa", "StateReport", nil)
+		resp.Context = roomProperties(room)
+		return resp
+	}
+
+	cmd, err := directiveCommand(room, d)
+	if errors.Is(err, errUnsupportedDirective) {
+		return d.ErrorResponse(alexa.ErrorInvalidDirective, d.Header.Namespace+"."+d.Header.Name+" is not supported")
+	}
+	if err != nil {
+		return d.ErrorResponse(alexa.ErrorInvalidValue, err.Error())
+	}
+
+	// Device calls may outlive the invocation, so they don't use its context.
+	ctx, rc := withRequestCalls(context.Background())
+	out := serveIntent(ctx, room, &IntentRequest{ID: d.Header.MessageID, Intent: cmd.Intent, Slots: cmd.Slots})
+	switch out.Outcome {
+	case outcomeError:
+		// A reprompt means a slot was missing or invalid.
+		if out.Reprompt != "" {
+			return d.ErrorResponse(alexa.ErrorInvalidValue, out.Text())
+		}
+		return d.ErrorResponse(alexa.ErrorInternal, out.Text())
+	case outcomeRefused:
+		return d.ModeErrorResponse("OTHER", out.Text())
+	}
+	if st := states.Get(room.ID); rc.Started() == 0 && (cmd.Already == nil || !st.Known() || !cmd.Already(st)) {
+		return d.ErrorResponse(alexa.ErrorEndpointUnreachable, "no device call was made")
+	}
+	rc.WaitFor(settleTimeout)
+	if err := rc.Err(); err != nil {
+		return d.ErrorResponse(alexa.ErrorEndpointUnreachable, err.Error())
+	}
+
+	resp := d.Response("Alexa", "Response", nil)
+	resp.Context = roomProperties(room)
+	return resp
+}
+
+// directiveCommand translates a directive into the intent it stands for.
+func directiveCommand(room Room, d *alexa.Directive) (smartHomeCommand, error) {
+	var p smartHomePayload
+	if len(d.Payload) > 0 {
+		if err := json.Unmarshal(d.Payload, &p); err != nil {
+			return smartHomeCommand{}, err
+		}
+	}
+	var cmd smartHomeCommand
+
+	switch d.Header.Namespace + "." + d.Header.Name {
+	case "Alexa.PowerController.TurnOn":
+		cmd.Intent = "ON"
+		cmd.Already = func(st RoomState) bool { return st.Power }
+	case "Alexa.PowerController.TurnOff":
+		cmd.Intent = "OFF"
+		cmd.Already = func(st RoomState) bool { return !st.Power }
+	case "Alexa.InputController.SelectInput":
+		if p.Input == "" {
+			return cmd, errors.New("no input")
+		}
+		cmd.Intent = "INPUT"
+		cmd.Slots = map[string]string{"InputType": smartHomeInput(room, p.Input)}
+	case "Alexa.Speaker.SetVolume":
+		if p.Volume == nil || *p.Volume < 0 || *p.Volume > 100 {
+			return cmd, errors.New("volume must be 0 to 100")
+		}
+		cmd.Intent = "VOLUME"
+		cmd.Slots = map[string]string{"Level": strconv.Itoa(speakerVolume(room, *p.Volume))}
+	case "Alexa.Speaker.AdjustVolume":
+		if p.Volume == nil || *p.Volume == 0 {
+			return cmd, errors.New("no volume change")
+		}
+		cmd.Intent = "VOLUMEUP"
+		if *p.Volume < 0 {
+			cmd.Intent = "VOLUMEDOWN"
+		}
+		if !p.VolumeDefault {
+			cmd.Slots = map[string]string{"Amount": strconv.Itoa(abs(*p.Volume))}
+		}
+	case "Alexa.Speaker.SetMute":
+		if p.Mute == nil {
+			return cmd, errors.New("no mute setting")
+		}
+		cmd.Intent = "UNMUTE"
+		if *p.Mute {
+			cmd.Intent = "MUTE"
+		}
+		mute := *p.Mute
+		cmd.Already = func(st RoomState) bool { return st.MuteKnown && st.Muted == mute }
+	case "Alexa.ChannelController.ChangeChannel":
+		channel := cmp.Or(p.Channel.Number, p.Channel.CallSign, p.Channel.AffiliateCallSign, p.ChannelMetadata.Name)
+		if channel == "" {
+			return cmd, errors.New("no channel")
+		}
+		cmd.Intent = "CHANNEL"
+		cmd.Slots = map[string]string{"Number": channel}
+	case "Alexa.ChannelController.SkipChannels":
+		if p.ChannelCount == 0 || p.ChannelCount < -maxSkipChannels || p.ChannelCount > maxSkipChannels {
+			return cmd, fmt.Errorf("channel count must be from 1 to %d channels either way", maxSkipChannels)
+		}
+		cmd.Intent = "CHANNELUP"
+		if p.ChannelCount < 0 {
+			cmd.Intent = "CHANNELDOWN"
+		}
+		cmd.Slots = map[string]string{"Channels": strconv.Itoa(abs(p.ChannelCount))}
+	default:
+		intent, ok := playbackIntents[d.Header.Name]
+		if d.Header.Namespace != "Alexa.PlaybackController" || !ok {
+			return cmd, errUnsupportedDirective
+		}
+		cmd.Intent = intent
+	}
+	return cmd, nil
+}
+
+// smartHomeInput resolves an InputController input name to an InputMap key:
+// a key itself, one of Alexa's standard names, or an input's display name.
+// Anything else is passed on as spoken, and so launches as a Roku app.
+func smartHomeInput(room Room, name string) string {
+	key := strings.ToUpper(strings.ReplaceAll(name, " ", ""))
+	if _, ok := room.InputMap[key]; ok {
+		return key
+	}
+	if mapped, ok := smartHomeInputs[key]; ok {
+		return mapped
+	}
+	for _, in := range screenInputs(room, RoomState{}) {
+		if strings.ToUpper(strings.ReplaceAll(in.Name, " ", "")) == key {
+			return in.Key
+		}
+	}
+	return key
+}
+
+// discoveryEndpoints describes every room as a TV endpoint.
+func discoveryEndpoints() []alexa.DiscoveryEndpoint {
+	ids := make([]string, 0, len(Rooms))
+	for id := range Rooms {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	endpoints := make([]alexa.DiscoveryEndpoint, 0, len(ids))
+	for _, id := range ids {
+		room := Rooms[id]
+		input := alexa.NewCapability("Alexa.InputController", "input")
+		for _, in := range screenInputs(room, RoomState{}) {
+			input.Inputs = append(input.Inputs, alexa.NamedInput{Name: strings.ToUpper(in.Name)})
+		}
+		playback := alexa.NewCapability("Alexa.PlaybackController")
+		playback.SupportedOperations = []string{"Play", "FastForward", "Rewind"}
+
+		description := room.Name + " TV and Roku"
+		if room.ReceiverHost != "" {
+			description = room.Name + " TV, Roku and receiver"
+		}
+		endpoints = append(endpoints, alexa.DiscoveryEndpoint{
+			EndpointID:        room.ID,
+			ManufacturerName:  "go-alexa-api",
+			FriendlyName:      room.Name + " TV",
+			Description:       description,
+			DisplayCategories: []string{"TV"},
+			Capabilities: []alexa.Capability{
+				alexa.NewCapability("Alexa"),
+				alexa.NewCapability("Alexa.PowerController", "powerState"),
+				input,
+				alexa.NewCapability("Alexa.Speaker", "volume", "muted"),
+				alexa.NewCapability("Alexa.ChannelController"),
+				playback,
+			},
+		})
+	}
+	return endpoints
+}
+
+// roomProperties reports a room's tracked state. Nothing is reported until
+// the state is known.
+func roomProperties(room Room) *alexa.EventContext {
+	ec := &alexa.EventContext{Properties: []alexa.Property{}}
+	st := states.Get(room.ID)
+	if !st.Known() {
+		return ec
+	}
+	sampled := func(namespace, name string, value any) alexa.Property {
+		p := alexa.NewProperty(namespace, name, value, st.Updated)
+		p.UncertaintyInMilliseconds = int(time.Since(st.Updated).Milliseconds())
+		return p
+	}
+
+	power := "OFF"
+	if st.Power {
+		power = "ON"
+	}
+	ec.Properties = append(ec.Properties, sampled("Alexa.PowerController", "powerState", power))
+	if st.MuteKnown {
+		ec.Properties = append(ec.Properties, sampled("Alexa.Speaker", "muted", st.Muted))
+	}
+	if st.VolumeKnown {
+		ec.Properties = append(ec.Properties, sampled("Alexa.Speaker", "volume", min(max(speakerVolume(room, st.Volume), 0), 100)))
+	}
+	if st.Input != "" {
+		ec.Properties = append(ec.Properties, sampled("Alexa.InputController", "input", strings.ToUpper(inputName(room, st.Input, st.Input))))
+	}
+	return ec
+}
+
+// speakerVolume converts between a room's volume level and Alexa.Speaker's
+// 0 to 100, on which 100 is loudest. TV levels already run that way.
+// Receiver levels are dB of attenuation, so they are flipped, which works in
+// both directions.
+func speakerVolume(room Room, level int) int {
+	if room.ReceiverHost == "" {
+		return level
+	}
+	return 100 - level
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
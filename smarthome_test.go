@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+// invokeLambda plays the part of the Lambda runtime: it sends a directive
+// event through the handler as raw JSON and decodes the reply.
+func invokeLambda(t *testing.T, namespace, name, endpointID, payload string) alexa.SmartHomeResponse {
+	t.Helper()
+	endpoint := ""
+	if endpointID != "" {
+		endpoint = `"endpoint": {"scope": {"type": "BearerToken", "token": "lwa-token"}, "endpointId": "` + endpointID + `"},`
+	}
+	event := `{"directive": {"header": {"namespace": "` + namespace + `", "name": "` + name + `", "payloadVersion": "3", "messageId": "msg-1", "correlationToken": "corr-1"}, ` + endpoint + ` "payload": ` + payload + `}}`
+	out, err := alexa.SmartHomeFunc(handleSmartHome).Invoke(context.Background(), []byte(event))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp alexa.SmartHomeResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// property returns the named property reported in resp, or nil.
+func property(resp alexa.SmartHomeResponse, namespace, name string) any {
+	if resp.Context == nil {
+		return nil
+	}
+	for _, p := range resp.Context.Properties {
+		if p.Namespace == namespace && p.Name == name {
+			return p.Value
+		}
+	}
+	return nil
+}
+
+// smartHomeRoom registers a test room backed by a device server that
+// accepts every call, and returns a function removing it.
+func smartHomeRoom() func() {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	room := testRoom(device.URL, device.URL, device.URL)
+	Rooms[room.ID] = room
+	return func() {
+		delete(Rooms, room.ID)
+		device.Close()
+	}
+}
+
+func TestSmartHome_Discovery(t *testing.T) {
+	resp := invokeLambda(t, "Alexa.Discovery", "Discover", "", `{"scope": {"type": "BearerToken", "token": "lwa-token"}}`)
+	if resp.Event.Header.Namespace != "Alexa.Discovery" || resp.Event.Header.Name != "Discover.Response" {
+		t.Fatalf("header = %+v", resp.Event.Header)
+	}
+	var payload struct{ Endpoints []alexa.DiscoveryEndpoint }
+	b, _ := json.Marshal(resp.Event.Payload)
+	json.Unmarshal(b, &payload)
+	if len(payload.Endpoints) != 2 || payload.Endpoints[0].EndpointID != "fr" || payload.Endpoints[0].FriendlyName != "Family Room TV" {
+		t.Fatalf("endpoints = %+v", payload.Endpoints)
+	}
+	interfaces := map[string]alexa.Capability{}
+	for _, c := range payload.Endpoints[0].Capabilities {
+		interfaces[c.Interface] = c
+	}
+	for _, iface := range []string{"Alexa", "Alexa.PowerController", "Alexa.InputController", "Alexa.Speaker", "Alexa.ChannelController", "Alexa.PlaybackController"} {
+		if _, ok := interfaces[iface]; !ok {
+			t.Errorf("missing %s", iface)
+		}
+	}
+	inputs := map[string]bool{}
+	for _, in := range interfaces["Alexa.InputController"].Inputs {
+		inputs[in.Name] = true
+	}
+	if !inputs["NETFLIX"] || !inputs["PS4"] || inputs["NET"] {
+		t.Errorf("inputs = %v", inputs)
+	}
+}
+
+func TestSmartHome_Directives(t *testing.T) {
+	defer smartHomeRoom()()
+
+	resp := invokeLambda(t, "Alexa.InputController", "SelectInput", "test", `{"input": "Netflix"}`)
+	if resp.Event.Header.Name != "Response" || resp.Event.Header.CorrelationToken != "corr-1" || resp.Event.Endpoint.EndpointID != "test" {
+		t.Fatalf("event = %+v", resp.Event)
+	}
+	if property(resp, "Alexa.PowerController", "powerState") != "ON" || property(resp, "Alexa.InputController", "input") != "NETFLIX" {
+		t.Errorf("properties = %+v", resp.Context)
+	}
+
+	// The receiver takes dB of attenuation: 40 of 100 is 60 dB down.
+	resp = invokeLambda(t, "Alexa.Speaker", "SetVolume", "test", `{"volume": 40}`)
+	if property(resp, "Alexa.Speaker", "volume") != 40.0 || states.Get("test").Volume != 60 {
+		t.Errorf("volume = %v, receiver level %d", property(resp, "Alexa.Speaker", "volume"), states.Get("test").Volume)
+	}
+	resp = invokeLambda(t, "Alexa.Speaker", "AdjustVolume", "test", `{"volume": -10, "volumeDefault": false}`)
+	if property(resp, "Alexa.Speaker", "volume") != 30.0 || states.Get("test").Volume != 70 {
+		t.Errorf("quieter receiver volume = %v, want 30", property(resp, "Alexa.Speaker", "volume"))
+	}
+	resp = invokeLambda(t, "Alexa.Speaker", "SetVolume", "test", `{"volume": 100}`)
+	if property(resp, "Alexa.Speaker", "volume") != 100.0 || states.Get("test").Volume != 0 {
+		t.Errorf("loudest volume = %v, receiver level %d", property(resp, "Alexa.Speaker", "volume"), states.Get("test").Volume)
+	}
+	resp = invokeLambda(t, "Alexa.Speaker", "SetMute", "test", `{"mute":true}`)
+	if property(resp, "Alexa.Speaker", "muted") != true {
+		t.Errorf("muted = %v", property(resp, "Alexa.Speaker", "muted"))
+	}
+
+	room := Rooms["test"]
+	room.Channels = map[string]ChannelConfig{"PBSKIDS": {Number: "9.2"}}
+	Rooms["test"] = room
+	resp = invokeLambda(t, "Alexa.ChannelController", "ChangeChannel", "test", `{"channel": {"callSign": "PBS Kids"}}`)
+	if resp.Event.Header.Name != "Response" {
+		t.Errorf("named channel: event %+v", resp.Event)
+	}
+
+	resp = invokeLambda(t, "Alexa", "ReportState", "test", `{}`)
+	if resp.Event.Header.Name != "StateReport" || property(resp, "Alexa.Speaker", "muted") != true {
+		t.Errorf("state report = %+v", resp)
+	}
+
+	resp = invokeLambda(t, "Alexa.PowerController", "TurnOff", "test", `{}`)
+	if property(resp, "Alexa.PowerController", "powerState") != "OFF" {
+		t.Errorf("powerState = %v", property(resp, "Alexa.PowerController", "powerState"))
+	}
+}
+
+func TestSmartHome_Errors(t *testing.T) {
+	defer smartHomeRoom()()
+
+	tests := []struct {
+		namespace, name, endpoint, payload, want string
+	}{
+		{"Alexa.PowerController", "TurnOn", "garage", `{}`, alexa.ErrorNoSuchEndpoint},
+		{"Alexa.ThermostatController", "SetTargetTemperature", "test", `{}`, alexa.ErrorInvalidDirective},
+		{"Alexa.PlaybackController", "Pause", "test", `{}`, alexa.ErrorInvalidDirective},
+		{"Alexa.Speaker", "SetVolume", "test", `{"volume": 150}`, alexa.ErrorInvalidValue},
+		{"Alexa.ChannelController", "ChangeChannel", "test", `{"channel": {"callSign": "PBS"}}`, alexa.ErrorInvalidValue},
+		{"Alexa.Speaker", "AdjustVolume", "test", `{"volume": 5}`, alexa.ErrorNotSupportedInCurrentMode},
+		{"Alexa.ChannelController", "SkipChannels", "test", `{"channelCount": 100}`, alexa.ErrorInvalidValue},
+		{"Alexa.ChannelController", "SkipChannels", "test", `{"channelCount": -9223372036854775808}`, alexa.ErrorInvalidValue},
+	}
+	for _, tt := range tests {
+		resp := invokeLambda(t, tt.namespace, tt.name, tt.endpoint, tt.payload)
+		payload, _ := resp.Event.Payload.(map[string]any)
+		if resp.Event.Header.Name != "ErrorResponse" || payload["type"] != tt.want {
+			t.Errorf("%s.%s: event %+v, want %s", tt.namespace, tt.name, resp.Event, tt.want)
+		}
+	}
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	room := Rooms["test"]
+	room.TVActionHost = down.URL
+	Rooms["test"] = room
+	resp := invokeLambda(t, "Alexa.ChannelController", "SkipChannels", "test", `{"channelCount": 2}`)
+	if payload, _ := resp.Event.Payload.(map[string]any); payload["type"] != alexa.ErrorEndpointUnreachable {
+		t.Errorf("unreachable TV: event %+v", resp.Event)
+	}
+}
+
+func TestSmartHome_VolumeFromZero(t *testing.T) {
+	defer smartHomeRoom()()
+	room := Rooms["test"]
+	room.ReceiverHost = ""
+	Rooms["test"] = room
+	states.Update("test", func(s *RoomState) { s.Power = true; s.Volume = 0; s.VolumeKnown = true })
+
+	resp := invokeLambda(t, "Alexa", "ReportState", "test", `{}`)
+	if v, ok := property(resp, "Alexa.Speaker", "volume").(float64); !ok || v != 0 {
+		t.Errorf("reported volume = %v, want 0", property(resp, "Alexa.Speaker", "volume"))
+	}
+
+	resp = invokeLambda(t, "Alexa.Speaker", "AdjustVolume", "test", `{"volume": 5}`)
+	if resp.Event.Header.Name != "Response" {
+		t.Fatalf("AdjustVolume from 0: event %+v", resp.Event)
+	}
+	if v, ok := property(resp, "Alexa.Speaker", "volume").(float64); !ok || v != 5 {
+		t.Errorf("volume after AdjustVolume = %v, want 5", property(resp, "Alexa.Speaker", "volume"))
+	}
+}
+
+func TestSmartHome_LeftAlone(t *testing.T) {
+	defer smartHomeRoom()()
+	room := Rooms["test"]
+	room.ReceiverHost = ""
+	room.Capabilities = Capabilities{}
+	Rooms["test"] = room
+
+	// A toggle-only TV in an unknown state is left alone, which is no success.
+	resp := invokeLambda(t, "Alexa.PowerController", "TurnOff", "test", `{}`)
+	if payload, _ := resp.Event.Payload.(map[string]any); payload["type"] != alexa.ErrorNotSupportedInCurrentMode {
+		t.Errorf("unknown power: event %+v", resp.Event)
+	}
+
+	// Already off: nothing to send, and nothing wrong.
+	states.Update("test", func(s *RoomState) { s.Power = false })
+	resp = invokeLambda(t, "Alexa.PowerController", "TurnOff", "test", `{}`)
+	if resp.Event.Header.Name != "Response" || property(resp, "Alexa.PowerController", "powerState") != "OFF" {
+		t.Errorf("already off: event %+v", resp.Event)
+	}
+}
+
+func TestSmartHome_SkipChannelsInOrder(t *testing.T) {
+	tv := &deviceRecorder{}
+	server := httptest.NewServer(tv)
+	defer server.Close()
+	room := testRoom(server.URL, "", "")
+	addRoom(t, room)
+	commands = NewCommandLog(commandLogLimit)
+
+	resp := invokeLambda(t, "Alexa.ChannelController", "SkipChannels", "test", `{"channelCount": -3}`)
+	if resp.Event.Header.Name != "Response" {
+		t.Fatalf("event %+v", resp.Event)
+	}
+	pending.Wait()
+	if got := strings.Join(tv.Calls(), " "); got != strings.Repeat(`{"command":"ChannelDown"} `, 2)+`{"command":"ChannelDown"}` {
+		t.Errorf("TV calls = %s", got)
+	}
+	if history := commands.Recent("test"); len(history) != 1 || history[0].Slots["Channels"] != "3" {
+		t.Errorf("command log = %+v", history)
+	}
+}
+
+func TestSmartHomeInput(t *testing.T) {
+	for name, want := range map[string]string{"Netflix": "NETFLIX", "PLAYSTATION 4": "PS4", "Prime Video": "AMAZON", "Wii U": "WIIU", "Hulu": "HULU"} {
+		if got := smartHomeInput(FamilyRoom, name); got != want {
+			t.Errorf("smartHomeInput(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSmartHome_HTTPRequiresToken(t *testing.T) {
+	srv := httptest.NewServer(newRouter(smartHomeFrontend{token: "secret"}))
+	defer srv.Close()
+
+	event := `{"directive": {"header": {"namespace": "Alexa.Discovery", "name": "Discover", "payloadVersion": "3", "messageId": "1"}, "payload": {}}}`
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "secret": http.StatusOK} {
+		req, _ := http.NewRequest("POST", srv.URL+"/smarthome", strings.NewReader(event))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("token %q: status %d, want %d", token, resp.StatusCode, want)
+		}
+	}
+}
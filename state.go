@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RoomState is the last known state of a room's devices. It is updated from
+// successful device commands and, when polling is enabled, from the receiver.
+type RoomState struct {
+	Power   bool      `json:"power"`
+	Input   string    `json:"input,omitempty"` // InputMap key of the current input
+	Volume  int       `json:"volume"`          // spoken volume level; receivers are sent its negation in dB
+	Muted   bool      `json:"muted"`
+	RokuApp string    `json:"rokuApp,omitempty"`
+	Updated time.Time `json:"updated"`
+
+	// VolumeKnown is set once Volume has been recorded, since 0 is a real
+	// level.
+	VolumeKnown bool `json:"volumeKnown"`
+	// MuteKnown is set once Muted has been recorded. Other updates, such
+	// as power, say nothing about it.
+	MuteKnown bool `json:"muteKnown"`
+}
+
+// Known reports whether anything has been recorded for the room yet.
+func (s RoomState) Known() bool {
+	return !s.Updated.IsZero()
+}
+
+// StateStore holds the tracked state of every room.
+type StateStore struct {
+	mu    sync.Mutex
+	rooms map[string]RoomState
+}
+
+// states is the process-wide room state store.
+var states = NewStateStore()
+
+// NewStateStore returns an empty state store.
+func NewStateStore() *StateStore {
+	return &StateStore{rooms: make(map[string]RoomState)}
+}
+
+// Get returns the tracked state for a room.
+func (s *StateStore) Get(roomID string) RoomState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rooms[roomID]
+}
+
+// Update applies fn to the room's state and stamps the update time. It
+// reports whether anything but the time changed.
+func (s *StateStore) Update(roomID string, fn func(*RoomState)) (changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.rooms[roomID]
+	st := old
+	fn(&st)
+	st.Updated = old.Updated
+	changed = st != old
+	st.Updated = time.Now()
+	s.rooms[roomID] = st
+	return changed
+}
+
+// track runs a device call in the background and, once it succeeds, applies
+// update to the room's tracked state.
+func track(ctx context.Context, room Room, call func() error, update func(*RoomState)) {
+	if update != nil {
+		expect(ctx, update)
+	}
+	background(ctx, func() {
+		if err := call(); err != nil {
+			return
+		}
+		if update != nil {
+			applyUpdate(ctx, room, update)
+		}
+	})
+}
+
+// applyUpdate applies a successful device call's update to the room's
+// tracked state. The first update of an undoable intent that changes
+// anything pushes the state the intent started from onto the history.
+func applyUpdate(ctx context.Context, room Room, update func(*RoomState)) {
+	if !states.Update(room.ID, update) {
+		return
+	}
+	if p, ok := ctx.Value(undoPointKey{}).(*undoPoint); ok {
+		p.once.Do(func() { history.Push(room.ID, p.st) })
+	}
+}
+
+// expect notes a state change the request's device calls will make, so
+// replies can show it before they finish.
+func expect(ctx context.Context, update func(*RoomState)) {
+	if rc, ok := ctx.Value(requestCallsKey{}).(*requestCalls); ok {
+		rc.expect(update)
+	}
+}
+
+// pollStates refreshes tracked state from each room's receiver every
+// interval until ctx is done.
+func pollStates(ctx context.Context, interval time.Duration) {
+	for {
+		for _, room := range Rooms {
+			pollRoom(room)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// pollRoom refreshes one room's tracked state from its receiver, if it has one.
+func pollRoom(room Room) {
+	if room.ReceiverHost == "" {
+		return
+	}
+	status, err := getReceiver(room.ReceiverHost)
+	if err != nil {
+		slog.Warn("polling receiver", "room", room.ID, "err", err)
+		return
+	}
+	states.Update(room.ID, func(s *RoomState) {
+		s.Power = status.On
+		s.Muted = status.Mute
+		s.MuteKnown = true
+		if db, err := strconv.ParseFloat(status.Volume.String(), 64); err == nil {
+			s.Volume = -int(db)
+			s.VolumeKnown = true
+		}
+		// The receiver only knows its own input; forget ours if it changed.
+		if cfg, ok := room.InputMap[s.Input]; !ok || cfg.ReceiverInput != status.Input {
+			s.Input = ""
+			s.RokuApp = ""
+		}
+	})
+}
+
+// describeState renders a room's tracked state for speech.
+func describeState(room Room, s RoomState) string {
+	if !s.Known() {
+		return "I don't know what's on in the " + room.Name + " yet."
+	}
+	if !s.Power {
+		return "The " + room.Name + " is off."
+	}
+
+	out := "The " + room.Name + " is on"
+	switch {
+	case s.RokuApp != "":
+		out += " " + s.RokuApp
+	case s.Input != "":
+		out += " " + s.Input
+	}
+	if s.Muted {
+		out += ", muted"
+	} else if s.VolumeKnown {
+		out += fmt.Sprintf(", volume %d", s.Volume)
+	}
+	return out + "."
+}
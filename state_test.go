@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStateStore_Update(t *testing.T) {
+	s := NewStateStore()
+	if s.Get("fr").Known() {
+		t.Fatal("expected unknown state for new store")
+	}
+
+	s.Update("fr", func(st *RoomState) { st.Power = true; st.Input = "NETFLIX" })
+	st := s.Get("fr")
+	if !st.Known() || !st.Power || st.Input != "NETFLIX" {
+		t.Errorf("unexpected state: %+v", st)
+	}
+	if s.Get("mbr").Known() {
+		t.Error("update leaked into another room")
+	}
+}
+
+func TestTrack_OnlyUpdatesOnSuccess(t *testing.T) {
+	resetState()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	room := testRoom(failing.URL, "", "")
+	ctx := context.Background()
+	track(ctx, room, func() error { return executeAction(ctx, room.TVActionHost, "PowerOff", "") },
+		func(s *RoomState) { s.Power = false })
+	pending.Wait()
+
+	if states.Get(room.ID).Known() {
+		t.Error("state should not change when the device call fails")
+	}
+}
+
+func TestPollRoom(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"on": true, "volume": "-45", "input": "HDMI1", "mute": true}`))
+	}))
+	defer receiver.Close()
+
+	room := testRoom("", "", receiver.URL)
+	states.Update(room.ID, func(s *RoomState) { s.Input = "TV" })
+
+	pollRoom(room)
+
+	st := states.Get(room.ID)
+	if !st.Power || !st.Muted || st.Volume != 45 {
+		t.Errorf("unexpected polled state: %+v", st)
+	}
+	if st.Input != "" {
+		t.Errorf("expected input cleared after receiver input changed, got %q", st.Input)
+	}
+}
+
+func TestDescribeState(t *testing.T) {
+	room := Room{Name: "Family Room"}
+	now := time.Now()
+
+	tests := []struct {
+		state RoomState
+		want  string
+	}{
+		{RoomState{}, "I don't know what's on in the Family Room yet."},
+		{RoomState{Updated: now}, "The Family Room is off."},
+		{RoomState{Power: true, Input: "NETFLIX", RokuApp: "Netflix", Volume: 30, VolumeKnown: true, Updated: now}, "The Family Room is on Netflix, volume 30."},
+		{RoomState{Power: true, Input: "PS4", Muted: true, Updated: now}, "The Family Room is on PS4, muted."},
+	}
+	for _, tt := range tests {
+		if got := describeState(room, tt.state); got != tt.want {
+			t.Errorf("describeState(%+v) = %q, want %q", tt.state, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracing is a small OpenTelemetry-compatible tracer: spans are exported in
+// the OTLP/HTTP JSON encoding to a collector, or written to stdout as JSON
+// lines. Like the metrics it is hand-rolled to keep the binary to the
+// standard library.
+
+// spanKind is the OTLP span kind.
+type spanKind int
+
+const (
+	spanInternal spanKind = 1
+	spanServer   spanKind = 2
+	spanClient   spanKind = 3
+)
+
+// Span is one timed operation in a trace. A nil *Span is a no-op, which is
+// what startSpan returns when tracing is disabled.
+type Span struct {
+	TraceID  string         `json:"trace_id"`
+	SpanID   string         `json:"span_id"`
+	ParentID string         `json:"parent_id,omitempty"`
+	Name     string         `json:"name"`
+	Kind     spanKind       `json:"-"`
+	Start    time.Time      `json:"start"`
+	Finish   time.Time      `json:"end"`
+	Attrs    map[string]any `json:"attributes,omitempty"`
+	Error    string         `json:"error,omitempty"`
+
+	mu     sync.Mutex
+	tracer *Tracer
+}
+
+type spanKey struct{}
+
+// tracer is the process-wide tracer; nil disables tracing.
+var tracer *Tracer
+
+// startSpan starts a span as a child of the span in ctx, if any, with attrs
+// given as key/value pairs.
+func startSpan(ctx context.Context, name string, kind spanKind, attrs ...any) (context.Context, *Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	s := &Span{SpanID: randomID(8), Name: name, Kind: kind, Start: time.Now(), Attrs: map[string]any{}, tracer: tracer}
+	if parent := spanFrom(ctx); parent != nil {
+		s.TraceID, s.ParentID = parent.TraceID, parent.SpanID
+	} else {
+		s.TraceID = randomID(16)
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.Attrs[fmt.Sprint(attrs[i])] = attrs[i+1]
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// spanFrom returns the span in ctx, or nil.
+func spanFrom(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SetAttr sets an attribute on the span.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attrs[key] = value
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = err.Error()
+}
+
+// End finishes the span and queues it for export.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Finish = time.Now()
+	s.mu.Unlock()
+	s.tracer.enqueue(s)
+}
+
+// traceparent returns the W3C trace context header for the span.
+func (s *Span) traceparent() string {
+	return "00-" + s.TraceID + "-" + s.SpanID + "-01"
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// spanExporter sends finished spans somewhere.
+type spanExporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// maxQueuedSpans bounds the spans waiting for export, so a collector that
+// is down can't grow the queue without limit.
+const maxQueuedSpans = 2048
+
+// Tracer batches finished spans and exports them every interval. Spans it
+// can't export are counted in trace_spans_dropped_total.
+type Tracer struct {
+	exporter spanExporter
+	mu       sync.Mutex
+	queue    []*Span
+	closed   bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewTracer starts a tracer exporting to exporter every interval.
+func NewTracer(exporter spanExporter, interval time.Duration) *Tracer {
+	t := &Tracer{exporter: exporter, stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.Flush(context.Background())
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case t.closed:
+		spansDroppedTotal.Add(1, "shutdown")
+	case len(t.queue) >= maxQueuedSpans:
+		spansDroppedTotal.Add(1, "queue_full")
+	default:
+		t.queue = append(t.queue, s)
+	}
+}
+
+// Flush exports every span finished so far.
+func (t *Tracer) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	spans := t.queue
+	t.queue = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+	if err := t.exporter.Export(ctx, spans); err != nil {
+		slog.Warn("exporting spans", "spans", len(spans), "err", err)
+		spansDroppedTotal.Add(float64(len(spans)), "export_error")
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops the export loop and flushes the remaining spans. Spans
+// that end afterwards are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	close(t.stop)
+	<-t.done
+	return t.Flush(ctx)
+}
+
+// newTracerFromEnv configures tracing from OTEL_TRACES_EXPORTER ("otlp",
+// "stdout" or "none"), OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_SERVICE_NAME.
+// It returns nil when tracing is disabled.
+func newTracerFromEnv(getenv func(string) string, stdout io.Writer) (*Tracer, error) {
+	switch strings.ToLower(getenv("OTEL_TRACES_EXPORTER")) {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		return NewTracer(&stdoutExporter{w: stdout}, time.Second), nil
+	case "otlp":
+		endpoint := getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "http://localhost:4318"
+		}
+		service := getenv("OTEL_SERVICE_NAME")
+		if service == "" {
+			service = "go-alexa-api"
+		}
+		return NewTracer(&otlpExporter{url: strings.TrimSuffix(endpoint, "/") + "/v1/traces", service: service}, 5*time.Second), nil
+	}
+	return nil, fmt.Errorf("invalid OTEL_TRACES_EXPORTER %q", getenv("OTEL_TRACES_EXPORTER"))
+}
+
+// stdoutExporter writes each span as a JSON line.
+type stdoutExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (e *stdoutExporter) Export(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		s.mu.Lock()
+		err := enc.Encode(s)
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// otlpExporter posts spans to an OTLP/HTTP collector using the JSON encoding.
+type otlpExporter struct {
+	url     string
+	service string
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              spanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpAttr(key string, v any) otlpAttribute {
+	var value otlpValue
+	switch v := v.(type) {
+	case bool:
+		value.BoolValue = &v
+	case int:
+		s := strconv.Itoa(v)
+		value.IntValue = &s
+	default:
+		s := fmt.Sprint(v)
+		value.StringValue = &s
+	}
+	return otlpAttribute{Key: key, Value: value}
+}
+
+func (e *otlpExporter) Export(ctx context.Context, spans []*Span) error {
+	var ss otlpScopeSpans
+	ss.Scope.Name = "github.com/terickson/go-alexa-api"
+	for _, s := range spans {
+		s.mu.Lock()
+		out := otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentID,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.Finish.UnixNano(), 10),
+		}
+		for key, v := range s.Attrs {
+			out.Attributes = append(out.Attributes, otlpAttr(key, v))
+		}
+		if s.Error != "" {
+			out.Status = otlpStatus{Code: 2, Message: s.Error}
+		}
+		s.mu.Unlock()
+		ss.Spans = append(ss.Spans, out)
+	}
+	var rs otlpResourceSpans
+	rs.Resource.Attributes = []otlpAttribute{otlpAttr("service.name", e.service)}
+	rs.ScopeSpans = []otlpScopeSpans{ss}
+
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{rs}})
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("POST %s: %s", e.url, resp.Status)
+	}
+	return nil
+}
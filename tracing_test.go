@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// spanRecorder is an exporter that keeps every span.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (r *spanRecorder) Export(ctx context.Context, spans []*Span) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestTracing_IntentAndDeviceSpans(t *testing.T) {
+	var mu sync.Mutex
+	var traceparents []string
+	device := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		mu.Unlock()
+	})
+	tv := httptest.NewServer(device)
+	defer tv.Close()
+	roku := httptest.NewServer(device)
+	defer roku.Close()
+	receiver := httptest.NewServer(device)
+	defer receiver.Close()
+
+	room := testRoom(tv.URL, roku.URL, receiver.URL)
+	addRoom(t, room)
+
+	recorder := &spanRecorder{}
+	tracer = NewTracer(recorder, time.Hour)
+	defer func() { tracer = nil }()
+
+	serveIntent(context.Background(), room, alexaIntentRequest(newEchoRequest("INPUT", map[string]string{"InputType": "netflix"})))
+	pending.Wait()
+	tracer.Shutdown(context.Background())
+
+	var root *Span
+	devices := map[string]*Span{}
+	for _, s := range recorder.spans {
+		switch {
+		case s.ParentID == "":
+			root = s
+		case s.Kind == spanClient:
+			devices[s.Attrs["device"].(string)+" "+s.Attrs["command"].(string)] = s
+		}
+	}
+	if root == nil || root.Name != "intent INPUT" || root.Attrs["room"] != "test" || root.Attrs["outcome"] != "ok" {
+		t.Fatalf("unexpected root span: %+v", root)
+	}
+	for _, key := range []string{"receiver update", "roku input", "tv PowerOn", "tv HDMI1"} {
+		s, ok := devices[key]
+		if !ok {
+			t.Errorf("missing device span %q in %v", key, devices)
+			continue
+		}
+		if s.TraceID != root.TraceID || s.ParentID != root.SpanID {
+			t.Errorf("%s: not a child of the intent span", key)
+		}
+		if s.Attrs["room"] != "test" || s.Attrs["status"] != 200 {
+			t.Errorf("%s: attributes %v", key, s.Attrs)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, tp := range traceparents {
+		if !strings.HasPrefix(tp, "00-"+root.TraceID+"-") {
+			t.Errorf("traceparent %q not in trace %s", tp, root.TraceID)
+		}
+	}
+}
+
+func TestTracing_Disabled(t *testing.T) {
+	ctx, span := startSpan(context.Background(), "noop", spanInternal)
+	if span != nil || spanFrom(ctx) != nil {
+		t.Fatal("expected no span with tracing disabled")
+	}
+	span.SetAttr("k", "v")
+	span.End()
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var got otlpRequest
+	var path string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer collector.Close()
+
+	env := map[string]string{"OTEL_TRACES_EXPORTER": "otlp", "OTEL_EXPORTER_OTLP_ENDPOINT": collector.URL}
+	tr, err := newTracerFromEnv(func(k string) string { return env[k] }, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer = tr
+	defer func() { tracer = nil }()
+
+	ctx, parent := startSpan(context.Background(), "intent OFF", spanServer, "room", "fr")
+	_, child := startSpan(ctx, "POST tv", spanClient, "status", 500)
+	child.SetError(io.ErrUnexpectedEOF)
+	child.End()
+	parent.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/v1/traces" {
+		t.Errorf("posted to %q", path)
+	}
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	c, p := spans[0], spans[1]
+	if len(p.TraceID) != 32 || len(p.SpanID) != 16 || c.ParentSpanID != p.SpanID {
+		t.Errorf("bad IDs: parent %s/%s child parent %s", p.TraceID, p.SpanID, c.ParentSpanID)
+	}
+	if c.Status.Code != 2 || c.Kind != spanClient {
+		t.Errorf("child status/kind = %+v/%d", c.Status, c.Kind)
+	}
+	if v := c.Attributes[0].Value.IntValue; c.Attributes[0].Key != "status" || v == nil || *v != "500" {
+		t.Errorf("child attributes = %+v", c.Attributes)
+	}
+}
+
+func TestNewTracerFromEnv_Invalid(t *testing.T) {
+	if _, err := newTracerFromEnv(func(string) string { return "zipkin" }, io.Discard); err == nil {
+		t.Error("expected error for unknown exporter")
+	}
+}
+
+// failingExporter rejects every export.
+type failingExporter struct{}
+
+func (failingExporter) Export(ctx context.Context, spans []*Span) error {
+	return io.ErrUnexpectedEOF
+}
+
+func TestTracer_CountsDroppedSpans(t *testing.T) {
+	exportErrors := spansDroppedTotal.Value("export_error")
+	afterShutdown := spansDroppedTotal.Value("shutdown")
+
+	tr := NewTracer(failingExporter{}, time.Hour)
+	for range 3 {
+		(&Span{tracer: tr}).End()
+	}
+	if err := tr.Shutdown(context.Background()); err == nil {
+		t.Error("expected the shutdown flush to report the export error")
+	}
+	(&Span{tracer: tr}).End()
+
+	if got := spansDroppedTotal.Value("export_error") - exportErrors; got != 3 {
+		t.Errorf("export_error drops = %v, want 3", got)
+	}
+	if got := spansDroppedTotal.Value("shutdown") - afterShutdown; got != 1 {
+		t.Errorf("shutdown drops = %v, want 1", got)
+	}
+}
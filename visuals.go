@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+// screenInputNames labels the direct (non-Roku) inputs listed on screen
+// devices, by InputMap key. Roku inputs are labelled with their app.
+var screenInputNames = map[string]string{
+	"TV":       "TV",
+	"RETROPIE": "RetroPie",
+	"PS2":      "PS2",
+	"PS3":      "PS3",
+	"PS4":      "PS4",
+	"PS5":      "PS5",
+	"WII":      "Wii",
+	"WIIU":     "Wii U",
+	"FIRETV":   "Fire TV",
+	"SWITCH":   "Switch",
+	"XBOX":     "Xbox",
+}
+
+// eventSlots names the slot that a touch event's second argument fills,
+// by intent.
+var eventSlots = map[string]string{
+	"INPUT":   "InputType",
+	"VOLUME":  "Level",
+	"CHANNEL": "Number",
+}
+
+// roomDocument is the APL document for a room: its state, a row of
+// controls and a list of inputs. Each touch sends a UserEvent whose
+// arguments are an intent name and, for inputs, the InputMap key.
+const roomDocument = `{
+  "type": "APL",
+  "version": "2023.3",
+  "mainTemplate": {
+    "parameters": ["payload"],
+    "items": [{
+      "type": "Container",
+      "width": "100vw",
+      "height": "100vh",
+      "paddingLeft": "32dp",
+      "paddingRight": "32dp",
+      "paddingTop": "24dp",
+      "items": [
+        {"type": "Text", "text": "${payload.room.name}", "fontSize": "40dp"},
+        {"type": "Text", "text": "${payload.room.status}", "fontSize": "24dp", "paddingBottom": "16dp"},
+        {
+          "type": "Container",
+          "direction": "row",
+          "data": "${payload.room.controls}",
+          "items": [{
+            "type": "TouchWrapper",
+            "paddingRight": "16dp",
+            "onPress": {"type": "SendEvent", "arguments": ["${data.intent}"]},
+            "item": {
+              "type": "Frame",
+              "borderWidth": "2dp",
+              "borderColor": "#ffffff",
+              "borderRadius": "8dp",
+              "paddingLeft": "16dp",
+              "paddingRight": "16dp",
+              "paddingTop": "8dp",
+              "paddingBottom": "8dp",
+              "item": {"type": "Text", "text": "${data.label}", "fontSize": "24dp"}
+            }
+          }]
+        },
+        {
+          "type": "Sequence",
+          "grow": 1,
+          "paddingTop": "16dp",
+          "data": "${payload.room.inputs}",
+          "items": [{
+            "type": "TouchWrapper",
+            "onPress": {"type": "SendEvent", "arguments": ["INPUT", "${data.key}"]},
+            "item": {
+              "type": "Text",
+              "text": "${data.name}",
+              "fontSize": "28dp",
+              "paddingTop": "12dp",
+              "paddingBottom": "12dp",
+              "color": "${data.current ? '#00caff' : '#ffffff'}"
+            }
+          }]
+        }
+      ]
+    }]
+  }
+}`
+
+// screenInput is one tappable input in the room document.
+type screenInput struct {
+	Key     string `json:"key"`
+	Name    string `json:"name"`
+	Current bool   `json:"current"`
+}
+
+// screenControl is one button in the room document.
+type screenControl struct {
+	Label  string `json:"label"`
+	Intent string `json:"intent"`
+}
+
+// hasScreen reports whether the request came from a device that renders APL.
+func hasScreen(echoReq *alexa.RequestEnvelope) bool {
+	return echoReq.Context.System.Device.Supports("Alexa.Presentation.APL")
+}
+
+// renderRoom adds the room document, filled in with st, to the response.
+// The session is left to the device so the document stays up for touches.
+func renderRoom(room Room, st RoomState, echoResp *alexa.ResponseEnvelope) {
+	inputs := screenInputs(room, st)
+
+	controls := []screenControl{{Label: "Power", Intent: "POWER"}}
+	if st.Muted {
+		controls = append(controls, screenControl{Label: "Unmute", Intent: "UNMUTE"})
+	} else {
+		controls = append(controls, screenControl{Label: "Mute", Intent: "MUTE"})
+	}
+	controls = append(controls,
+		screenControl{Label: "Volume Down", Intent: "VOLUMEDOWN"},
+		screenControl{Label: "Volume Up", Intent: "VOLUMEUP"},
+	)
+
+	echoResp.AddDirective(alexa.RenderDocumentDirective{
+		Type:     "Alexa.Presentation.APL.RenderDocument",
+		Token:    "room-" + room.ID,
+		Document: json.RawMessage(roomDocument),
+		Datasources: map[string]any{
+			"room": map[string]any{
+				"name":     room.Name,
+				"status":   describeState(room, st),
+				"power":    st.Power,
+				"input":    st.Input,
+				"volume":   st.Volume,
+				"muted":    st.Muted,
+				"inputs":   inputs,
+				"controls": controls,
+			},
+		},
+	})
+	if echoResp.Response.Reprompt == nil {
+		echoResp.Response.ShouldEndSession = nil
+	}
+}
+
+// screenInputs lists the room's inputs once each, sorted by name. Aliases
+// collapse to one entry: a named direct input's key, or for a Roku app the
+// key spelling its name, else the first key alphabetically.
+func screenInputs(room Room, st RoomState) []screenInput {
+	keys := make([]string, 0, len(room.InputMap))
+	for key := range room.InputMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	byName := make(map[string]string)
+	for _, key := range keys {
+		if name, ok := screenInputNames[key]; ok {
+			byName[name] = key
+			continue
+		}
+		app := room.InputMap[key].RokuApp
+		if app == "" {
+			continue
+		}
+		if _, ok := byName[app]; !ok || key == strings.ToUpper(strings.ReplaceAll(app, " ", "")) {
+			byName[app] = key
+		}
+	}
+
+	current := room.InputMap[st.Input]
+	inputs := make([]screenInput, 0, len(byName))
+	for name, key := range byName {
+		inputs = append(inputs, screenInput{
+			Key:     key,
+			Name:    name,
+			Current: st.Power && st.Input != "" && room.InputMap[key] == current,
+		})
+	}
+	sort.Slice(inputs, func(i, j int) bool {
+		return strings.ToLower(inputs[i].Name) < strings.ToLower(inputs[j].Name)
+	})
+	return inputs
+}
+
+// eventIntent turns a touch event into the intent it stands for, so taps
+// run through serveIntent like speech. It returns false for events this
+// skill did not send.
+func eventIntent(echoReq *alexa.RequestEnvelope) (alexa.Intent, bool) {
+	args := echoReq.Request.Arguments
+	if len(args) == 0 {
+		return alexa.Intent{}, false
+	}
+	name, ok := args[0].(string)
+	if !ok || name == "" {
+		return alexa.Intent{}, false
+	}
+	intent := alexa.Intent{Name: name}
+	if slot, ok := eventSlots[name]; ok && len(args) > 1 {
+		value, ok := args[1].(string)
+		if !ok {
+			return alexa.Intent{}, false
+		}
+		intent.Slots = map[string]alexa.Slot{slot: {Name: slot, Value: value}}
+	}
+	return intent, true
+}
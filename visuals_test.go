@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/terickson/go-alexa-api/alexa"
+)
+
+// withScreen marks a request as coming from an APL device.
+func withScreen(req *alexa.RequestEnvelope) *alexa.RequestEnvelope {
+	req.Context.System.Device.SupportedInterfaces = map[string]json.RawMessage{"Alexa.Presentation.APL": json.RawMessage(`{}`)}
+	return req
+}
+
+// renderedRoom returns the room datasource of the response's APL document.
+func renderedRoom(t *testing.T, echoResp *alexa.ResponseEnvelope) map[string]any {
+	t.Helper()
+	if len(echoResp.Response.Directives) != 1 {
+		t.Fatalf("expected one directive, got %d", len(echoResp.Response.Directives))
+	}
+	d, ok := echoResp.Response.Directives[0].(alexa.RenderDocumentDirective)
+	if !ok {
+		t.Fatalf("directive is %T", echoResp.Response.Directives[0])
+	}
+	if !json.Valid(d.Document) {
+		t.Fatal("document is not valid JSON")
+	}
+	return d.Datasources["room"].(map[string]any)
+}
+
+func TestScreenInputs(t *testing.T) {
+	inputs := screenInputs(FamilyRoom, RoomState{Power: true, Input: "NET"})
+	byName := map[string]screenInput{}
+	for _, in := range inputs {
+		if _, dup := byName[in.Name]; dup {
+			t.Errorf("%s listed twice", in.Name)
+		}
+		byName[in.Name] = in
+	}
+	for name, key := range map[string]string{"PS4": "PS4", "Wii U": "WIIU", "Netflix": "NETFLIX", "Prime Video": "AMAZON", "HBO GO": "HBO"} {
+		if byName[name].Key != key {
+			t.Errorf("%s: key %q, want %q", name, byName[name].Key, key)
+		}
+	}
+	if !byName["Netflix"].Current || byName["Plex"].Current {
+		t.Error("expected only Netflix to be current")
+	}
+	if inputs[0].Name != "Crunchyroll" {
+		t.Errorf("inputs not sorted: first is %s", inputs[0].Name)
+	}
+}
+
+func TestHandleIntent_Visuals(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer device.Close()
+	room := testRoom(device.URL, device.URL, device.URL)
+
+	echoResp := alexa.NewResponse()
+	handleIntent(room)(newEchoRequest("MUTE", nil), echoResp)
+	pending.Wait()
+	if c := echoResp.Response.Card; c == nil || c.Title != "Test Room" || c.Content != speechText(echoResp) {
+		t.Errorf("card = %+v", c)
+	}
+	if len(echoResp.Response.Directives) != 0 {
+		t.Error("rendered a document for a device without a screen")
+	}
+
+	echoResp = alexa.NewResponse()
+	handleIntent(room)(withScreen(newEchoRequest("INPUT", map[string]string{"InputType": "netflix"})), echoResp)
+	data := renderedRoom(t, echoResp)
+	if data["input"] != "NETFLIX" || data["status"] != "The Test Room is on Netflix, volume 30." {
+		t.Errorf("document shows %v / %v, want the state after the switch", data["input"], data["status"])
+	}
+	if echoResp.Response.ShouldEndSession != nil {
+		t.Error("session should be left open for touches")
+	}
+}
+
+func TestHandleIntent_ScreenDoesNotWaitForDevices(t *testing.T) {
+	release := make(chan struct{})
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer device.Close()
+	defer pending.Wait()
+	defer close(release)
+	room := testRoom(device.URL, "", "")
+	states.Update(room.ID, func(s *RoomState) { s.Power = true })
+
+	start := time.Now()
+	echoResp := alexa.NewResponse()
+	handleIntent(room)(withScreen(newEchoRequest("MUTE", nil)), echoResp)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("screen reply took %v waiting on a hung device", elapsed)
+	}
+	if data := renderedRoom(t, echoResp); data["status"] != "The Test Room is on, muted." {
+		t.Errorf("document shows %v, want the state after muting", data["status"])
+	}
+}
+
+func TestHandleUserEvent(t *testing.T) {
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer device.Close()
+	room := testRoom(device.URL, device.URL, device.URL)
+
+	event := withScreen(&alexa.RequestEnvelope{})
+	event.Request.Type = alexa.TypeAPLUserEvent
+	event.Request.Arguments = []any{"INPUT", "TV"}
+	echoResp := alexa.NewResponse()
+	handleUserEvent(room)(event, echoResp)
+	pending.Wait()
+
+	if st := states.Get(room.ID); st.Input != "TV" {
+		t.Errorf("input = %q, want TV", st.Input)
+	}
+	if echoResp.Response.OutputSpeech != nil {
+		t.Errorf("tap answered with speech %q", echoResp.Speech())
+	}
+	for _, in := range renderedRoom(t, echoResp)["inputs"].([]screenInput) {
+		if in.Current != (in.Key == "TV") {
+			t.Errorf("%s current = %v", in.Key, in.Current)
+		}
+	}
+
+	// With the volume unknown the tap is refused and says why.
+	states.Update(room.ID, func(s *RoomState) { s.VolumeKnown = false })
+	event.Request.Arguments = []any{"VOLUMEUP"}
+	echoResp = alexa.NewResponse()
+	handleUserEvent(room)(event, echoResp)
+	if got := echoResp.Speech(); got != "<speak>I don't know the current volume in the Test Room.</speak>" {
+		t.Errorf("refused tap speech = %q", got)
+	}
+
+	event.Request.Arguments = []any{42.0}
+	echoResp = alexa.NewResponse()
+	handleUserEvent(room)(event, echoResp)
+	renderedRoom(t, echoResp)
+}
+
+func TestEventIntent(t *testing.T) {
+	tests := []struct {
+		args []any
+		want string
+		slot string
+		ok   bool
+	}{
+		{[]any{"MUTE"}, "MUTE", "", true},
+		{[]any{"INPUT", "PS4"}, "INPUT", "PS4", true},
+		{[]any{"INPUT", 4.0}, "", "", false},
+		{[]any{}, "", "", false},
+	}
+	for _, tt := range tests {
+		req := &alexa.RequestEnvelope{}
+		req.Request.Arguments = tt.args
+		intent, ok := eventIntent(req)
+		if ok != tt.ok || intent.Name != tt.want || intent.Slots["InputType"].Value != tt.slot {
+			t.Errorf("eventIntent(%v) = %+v, %v", tt.args, intent, ok)
+		}
+	}
+}
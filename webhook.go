@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// webhookFrontend accepts intents as plain JSON, for Home Assistant, Google
+// Assistant bridges, or curl. Callers authenticate with token.
+type webhookFrontend struct {
+	token string
+}
+
+func (f webhookFrontend) Routes() map[string]http.Handler {
+	return map[string]http.Handler{"POST /webhook": requireToken(f.token, http.HandlerFunc(serveWebhook))}
+}
+
+// webhookRequest is the body accepted by the webhook.
+type webhookRequest struct {
+	Room   string            `json:"room"` // room ID or name
+	Intent string            `json:"intent"`
+	Slots  map[string]string `json:"slots,omitempty"`
+}
+
+// webhookResponse is the webhook's reply.
+type webhookResponse struct {
+	Speech   string `json:"speech"`
+	SSML     string `json:"ssml"`
+	Reprompt string `json:"reprompt,omitempty"`
+	Outcome  string `json:"outcome"`
+}
+
+func serveWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Intent == "" {
+		writeError(w, http.StatusBadRequest, "body must be {\"room\": ..., \"intent\": ..., \"slots\": {...}}")
+		return
+	}
+	room, ok := webhookRoom(req.Room)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "unknown room")
+		return
+	}
+	resp := serveIntent(context.Background(), room, &IntentRequest{Intent: req.Intent, Slots: req.Slots})
+	writeJSON(w, http.StatusOK, webhookResponse{Speech: resp.Text(), SSML: resp.Speech, Reprompt: resp.Reprompt, Outcome: resp.Outcome})
+}
+
+// webhookRoom finds a room by ID or by name, ignoring case.
+func webhookRoom(s string) (Room, bool) {
+	if room, ok := Rooms[strings.ToLower(s)]; ok {
+		return room, true
+	}
+	for _, room := range Rooms {
+		if strings.EqualFold(room.Name, s) {
+			return room, true
+		}
+	}
+	return Room{}, false
+}
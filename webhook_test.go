@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhook(t *testing.T) {
+	defer smartHomeRoom()()
+	h := newRouter(webhookFrontend{token: "secret"})
+
+	tests := []struct {
+		body        string
+		wantStatus  int
+		wantSpeech  string
+		wantOutcome string
+	}{
+		{`{"room": "test", "intent": "INPUT", "slots": {"InputType": "netflix"}}`, http.StatusOK, "The Test Room is on Netflix.", "ok"},
+		{`{"room": "Test Room", "intent": "volume", "slots": {"Level": "40"}}`, http.StatusOK, "Setting the Test Room volume to 40.", "ok"},
+		{`{"room": "test", "intent": "Bogus"}`, http.StatusOK, "", "error"},
+		{`{"room": "garage", "intent": "OFF"}`, http.StatusBadRequest, "", ""},
+		{`{"room": "test"}`, http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d", tt.body, rec.Code, tt.wantStatus)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var resp webhookResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Outcome != tt.wantOutcome || (tt.wantSpeech != "" && resp.Speech != tt.wantSpeech) {
+			t.Errorf("%s: response %+v", tt.body, resp)
+		}
+		if !strings.HasPrefix(resp.SSML, "<speak>") {
+			t.Errorf("%s: ssml = %q", tt.body, resp.SSML)
+		}
+	}
+	pending.Wait()
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"room": "test", "intent": "OFF"}`))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without token: status %d, want 401", rec.Code)
+	}
+}